@@ -0,0 +1,131 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+//Caller 调用者信息
+type Caller struct {
+	File     string
+	Line     int
+	Function string //完整的函数名 包含包路径
+	Package  string
+}
+
+//String 返回file:line
+func (c *Caller) String() string {
+	return fmt.Sprintf("%s:%d", c.File, c.Line)
+}
+
+//StackMode 完整堆栈的捕获方式
+type StackMode int
+
+//堆栈捕获方式
+const (
+	StackNever StackMode = iota //从不捕获
+	StackLevel                  //level >= StackLevel 时捕获
+	StackError                  //参数中包含error时捕获
+)
+
+func toStackMode(m string) StackMode {
+	if m == "Never" {
+		return StackNever
+	} else if m == "Error" {
+		return StackError
+	}
+	return StackLevel
+}
+
+//getCaller skip同runtime.Caller 从调用getCaller的函数开始计算
+func getCaller(skip int, trim bool) *Caller {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return nil
+	}
+	c := &Caller{
+		File: file,
+		Line: line,
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		c.Function = fn.Name()
+		c.Package = packageName(c.Function)
+	}
+	if trim {
+		c.File = trimPath(c.File, c.Package)
+	}
+	return c
+}
+
+//getStack 返回从skip开始的调用栈 格式与debug.Stack相近
+func getStack(skip int, trim bool) string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var buf bytes.Buffer
+	for {
+		frame, more := frames.Next()
+		file := frame.File
+		if trim {
+			file = trimPath(file, packageName(frame.Function))
+		}
+		fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.Function, file, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+//packageName 从函数名中取出包路径 如 github.com/a/b.(*T).Method 返回 github.com/a/b
+func packageName(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
+
+var (
+	modulePathOnce sync.Once
+	modulePath     string
+)
+
+//mainModulePath 主模块的路径 无法获取时返回空
+func mainModulePath() string {
+	modulePathOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			modulePath = info.Main.Path
+		}
+	})
+	return modulePath
+}
+
+//trimPath 把文件路径裁剪为相对于模块根目录的路径
+//主模块以外的包 使用包路径+文件名
+func trimPath(file string, pkg string) string {
+	base := path.Base(file)
+	if pkg == "" {
+		return base
+	}
+	if pkg == "main" {
+		//main包无法得到包路径 保留最后一级目录
+		return path.Join(path.Base(path.Dir(file)), base)
+	}
+	mod := mainModulePath()
+	if mod != "" {
+		if pkg == mod {
+			return base
+		}
+		if strings.HasPrefix(pkg, mod+"/") {
+			return path.Join(pkg[len(mod)+1:], base)
+		}
+	}
+	return path.Join(pkg, base)
+}
@@ -0,0 +1,103 @@
+package glog
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//callerEvent 写入1条日志 返回它的Caller
+func callerEvent(t *testing.T, trim bool, write func(l Logger)) *Caller {
+	t.Helper()
+	target := &eventTarget{targetFilter: newTargetFilter(nil)}
+	config := NewLogConfig()
+	config.TrimPath = trim
+	config.Layouts = []*Layout{{Target: target, Serializer: messageSerializer{}}}
+	m := NewWithConfig(config)
+	defer m.Close(context.Background())
+	write(m.GetLogger("app"))
+	events := target.received()
+	if len(events) != 1 || events[0].Caller == nil {
+		t.Fatalf("got %+v", events)
+	}
+	return events[0].Caller
+}
+
+//here 返回调用者的行号
+func here() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+//logWrapper 封装glog的库 通过WithCallerSkip(1)把调用者指向它的调用者
+func logWrapper(l Logger, msg string) {
+	l.WithCallerSkip(1).Infof("wrapped: %s", msg)
+}
+
+func TestCaller(t *testing.T) {
+	tests := []struct {
+		name  string
+		trim  bool
+		write func(l Logger) int //返回写入日志的行号
+	}{
+		{"direct", false, func(l Logger) int { l.Info("hello"); return here() }},
+		{"formatted", false, func(l Logger) int { l.Warnf("hello %d", 1); return here() }},
+		{"with error", false, func(l Logger) int { l.Err(context.Canceled).Error("failed"); return here() }},
+		{"WithCallerSkip", false, func(l Logger) int { logWrapper(l, "hello"); return here() }},
+		{"TrimPath", true, func(l Logger) int { l.Info("hello"); return here() }},
+		{"TrimPath WithCallerSkip", true, func(l Logger) int { logWrapper(l, "hello"); return here() }},
+	}
+	pc, _, _, _ := runtime.Caller(0)
+	self := runtime.FuncForPC(pc).Name()
+	pkg := packageName(self)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var line int
+			c := callerEvent(t, tt.trim, func(l Logger) { line = tt.write(l) })
+			if c.Line != line {
+				t.Fatalf("Line = %d, want %d", c.Line, line)
+			}
+			if !strings.HasPrefix(c.Function, self+".") || c.Package != pkg {
+				t.Fatalf("Function = %s Package = %s", c.Function, c.Package)
+			}
+			if !tt.trim {
+				if !filepath.IsAbs(c.File) || filepath.Base(c.File) != "caller_test.go" {
+					t.Fatalf("File = %s", c.File)
+				}
+				return
+			}
+			//测试时主模块就是glog 无法获取时使用包路径
+			want := "caller_test.go"
+			if mainModulePath() != pkg {
+				want = path.Join(pkg, want)
+			}
+			if c.File != want {
+				t.Fatalf("File = %s, want %s", c.File, want)
+			}
+		})
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	tests := []struct {
+		file, pkg, want string
+	}{
+		{"/src/app/cmd/server/main.go", "main", "server/main.go"},
+		{"/src/app/x.go", "", "x.go"},
+		{"/go/pkg/mod/example.com/lib@v1.2.0/sub/y.go", "example.com/lib/sub", "example.com/lib/sub/y.go"},
+	}
+	if mod := mainModulePath(); mod != "" {
+		tests = append(tests,
+			struct{ file, pkg, want string }{"/src/app/z.go", mod, "z.go"},
+			struct{ file, pkg, want string }{"/src/app/internal/db/z.go", mod + "/internal/db", "internal/db/z.go"},
+		)
+	}
+	for _, tt := range tests {
+		if got := trimPath(tt.file, tt.pkg); got != tt.want {
+			t.Fatalf("trimPath(%s, %s) = %s, want %s", tt.file, tt.pkg, got, tt.want)
+		}
+	}
+}
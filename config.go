@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -21,31 +22,68 @@ const (
 	InfoLevel
 	WarnLevel
 	ErrorLevel
+	PanicLevel
 	FatalLevel
 )
 
-//Layout 用于内部描述
+//Layout 1个Target以及它使用的Serializer 可以通过代码创建后加入LogConfig.Layouts
 type Layout struct {
+	ID         string //区分Layout 用于错误回调和统计 默认为Target的Type#序号
 	Target     Target
 	Serializer Serializer
+	Filter     *Filter   //为nil时不过滤 否则只写入满足表达式的日志
+	Sampler    *Sampler  //为nil时不采样
+	Redactor   *Redactor //为nil时不脱敏 否则在序列化之前替换敏感内容
+
+	state *layoutState
 }
 
 //LogConfig 文件配置
 type LogConfig struct {
-	Async   bool
-	Layouts []*Layout //只读
+	Async       bool
+	Layouts     []*Layout                //只读
+	StackMode   StackMode                //何时捕获完整堆栈 默认StackLevel
+	StackLevel  LogLevel                 //StackMode为StackLevel时 大于等于该级别捕获堆栈 默认ErrorLevel
+	TrimPath    bool                     //调用者文件路径裁剪为相对于模块根目录的路径
+	FatalExit   bool                     //Fatal写入并flush后调用os.Exit(1) 默认true
+	Loggers     map[string]*LoggerConfig //按logger名称的配置 只读
+	Middlewares []Middleware             //在通过Manager.Use添加的Middleware之后执行 只读
+	Fields      map[string]interface{}   //合并到每条日志的Properties 值为FieldFunc时每条日志调用1次 只读
+}
+
+//loggerConfig 返回logger的配置 没有单独配置时使用"*"
+func (config *LogConfig) loggerConfig(name string) *LoggerConfig {
+	if lc, ok := config.Loggers[name]; ok {
+		return lc
+	}
+	return config.Loggers["*"]
+}
+
+//NewLogConfig 返回默认配置 用于不使用配置文件时通过代码添加Layout
+func NewLogConfig() *LogConfig {
+	return &LogConfig{
+		Async:      false,
+		Layouts:    nil,
+		StackMode:  StackLevel,
+		StackLevel: ErrorLevel,
+		TrimPath:   false,
+		FatalExit:  true,
+		Loggers:    nil,
+	}
 }
 
 //ConfigFile 文件配置管理器
 type ConfigFile struct {
-	stop    chan bool
-	path    string
-	modTime time.Time
+	stop     chan bool //关闭时通知监控routine退出
+	done     chan bool //监控routine退出后关闭
+	stopOnce sync.Once
+	path     string
+	modTime  time.Time
 }
 
 func newConfigFile() *ConfigFile {
 	return &ConfigFile{
-		stop: make(chan bool), //无缓冲信号
+		stop: make(chan bool),
 	}
 }
 
@@ -86,12 +124,19 @@ func (file *ConfigFile) Load(path string) (lc *LogConfig, e error) {
 	return cf, nil
 }
 
-//StartMonitor 监控文件变化
-func (file *ConfigFile) StartMonitor(delegate func(config *LogConfig)) {
+//StartMonitor 监控文件变化 onError不为nil时 读取失败的错误通过它报告
+func (file *ConfigFile) StartMonitor(delegate func(config *LogConfig), onError func(err error)) {
+	if onError == nil {
+		onError = func(err error) {
+			log.Println("StartMonitor:", file.path, ":", err)
+		}
+	}
 	if file.path == "" {
 		return
 	}
+	file.done = make(chan bool)
 	go func() {
+		defer close(file.done)
 	loop:
 		for {
 			select {
@@ -100,8 +145,12 @@ func (file *ConfigFile) StartMonitor(delegate func(config *LogConfig)) {
 			case <-time.After(10 * time.Second):
 				stat, err := os.Stat(file.path)
 				//必须是文件
-				if err != nil || stat.IsDir() {
-					log.Println("StartMonitor 0:", file.path, ":", err)
+				if err != nil {
+					onError(err)
+					continue loop
+				}
+				if stat.IsDir() {
+					onError(fmt.Errorf("path is dir:%s", file.path))
 					continue loop
 				}
 				//文件修改时间不等则准备更新config
@@ -109,10 +158,10 @@ func (file *ConfigFile) StartMonitor(delegate func(config *LogConfig)) {
 					file.modTime = stat.ModTime()
 					config, err := file.Load(file.path)
 					if err != nil {
-						log.Println("StartMonitor 1 load fail:", file.path, ":", err)
+						onError(fmt.Errorf("load %s: %w", file.path, err))
 						continue loop
 					}
-					file.invoke(delegate, config)
+					file.invoke(delegate, config, onError)
 				}
 
 			}
@@ -121,34 +170,84 @@ func (file *ConfigFile) StartMonitor(delegate func(config *LogConfig)) {
 	}()
 }
 
-//StopMonitor 停止监控文件变化
+//StopMonitor 停止监控文件变化 并等待监控routine退出 可以多次调用
 func (file *ConfigFile) StopMonitor() {
-	file.stop <- true
+	file.stopOnce.Do(func() {
+		close(file.stop)
+	})
+	if file.done != nil {
+		<-file.done
+	}
 }
 
-func (file *ConfigFile) invoke(delegate func(config *LogConfig), config *LogConfig) {
+func (file *ConfigFile) invoke(delegate func(config *LogConfig), config *LogConfig, onError func(err error)) {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println("invoke 0:", err)
+			onError(fmt.Errorf("reload: %+v", err))
 		}
 	}()
 	delegate(config)
 }
 
-func convert(content map[string]interface{}) (*LogConfig, error) {
-
+func convert(content map[string]interface{}) (lc *LogConfig, e error) {
+	var targets []Target
+	defer func() {
+		//配置有错误(包括panic)时关闭已经创建的Target
+		if lc == nil {
+			for _, t := range targets {
+				closeTarget(t)
+			}
+		}
+	}()
 	if _, ok := content["Layouts"]; !ok {
 		return nil, errors.New("Layouts missed")
 	}
 	layouts := content["Layouts"].([]interface{})
-	//设置默认值
-	config := &LogConfig{
-		Async:   false,
-		Layouts: nil,
-	}
+	config := NewLogConfig()
 	if v, ok := content["Async"]; ok {
 		config.Async = v.(bool)
 	}
+	if v, ok := content["Stack"]; ok {
+		stack := v.(map[string]interface{})
+		if mode, ok := stack["Mode"]; ok {
+			config.StackMode = toStackMode(mode.(string))
+		}
+		if level, ok := stack["Level"]; ok {
+			config.StackLevel = toLevel(level.(string))
+		}
+	}
+	if v, ok := content["TrimPath"]; ok {
+		config.TrimPath = v.(bool)
+	}
+	if v, ok := content["FatalExit"]; ok {
+		config.FatalExit = v.(bool)
+	}
+	if v, ok := content["Loggers"].(map[string]interface{}); ok {
+		config.Loggers = make(map[string]*LoggerConfig)
+		for name, lc := range v {
+			tmp, _ := lc.(map[string]interface{})
+			config.Loggers[name] = &LoggerConfig{
+				Sampler: parseSampler(configMap(tmp, "Sampling")),
+				Dedup:   parseDeduper(configMap(tmp, "Dedup")),
+			}
+		}
+	}
+	dynamic, _ := content["DynamicFields"].([]interface{})
+	fields, err := parseFields(configMap(content, "Fields"), dynamic)
+	if err != nil {
+		return nil, err
+	}
+	config.Fields = fields
+	if v, ok := content["Middlewares"].([]interface{}); ok {
+		for _, name := range v {
+			s, _ := name.(string)
+			mw, err := findMiddleware(s)
+			if err != nil {
+				return nil, err
+			}
+			config.Middlewares = append(config.Middlewares, mw)
+		}
+	}
 	for _, v := range layouts {
 		tmp := v.(map[string]interface{})
 		layout := &Layout{}
@@ -157,8 +256,31 @@ func convert(content map[string]interface{}) (*LogConfig, error) {
 		layout.Serializer = findSerializer(seType)
 		tt := tmp["Target"].(map[string]interface{})
 		ttType := tt["Type"].(string)
+		if id, ok := tmp["ID"]; ok {
+			layout.ID = id.(string)
+		} else {
+			layout.ID = fmt.Sprintf("%s#%d", ttType, len(config.Layouts))
+		}
+		//与Filter Redact一样 Target创建失败时加载失败 原因由Target输出到标准log
 		layout.Target = findTarget(ttType, tt)
-		if layout.Serializer != nil && layout.Target != nil {
+		if layout.Target == nil {
+			return nil, fmt.Errorf("%s: create %s target failed", layout.ID, ttType)
+		}
+		targets = append(targets, layout.Target)
+		if filter, ok := tmp["Filter"].(string); ok && filter != "" {
+			f, err := CompileFilter(filter)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", layout.ID, err)
+			}
+			layout.Filter = f
+		}
+		layout.Sampler = parseSampler(configMap(tmp, "Sampling"))
+		redactor, err := parseRedactor(configMap(tmp, "Redact"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layout.ID, err)
+		}
+		layout.Redactor = redactor
+		if layout.Serializer != nil {
 			config.Layouts = append(config.Layouts, layout)
 		}
 	}
@@ -0,0 +1,49 @@
+package glog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertTargetErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "net without address",
+			target: map[string]interface{}{"Type": "net"},
+			err:    "net#0: create net target failed",
+		},
+		{
+			name:   "spool without target",
+			target: map[string]interface{}{"Type": "spool"},
+			err:    "spool#0: create spool target failed",
+		},
+		{
+			name: "failover with a bad child",
+			target: map[string]interface{}{"Type": "failover", "Targets": []interface{}{
+				map[string]interface{}{"Type": "console"},
+				map[string]interface{}{"Type": "net"},
+			}},
+			err: "failover#0: create failover target failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := map[string]interface{}{
+				"Layouts": []interface{}{
+					map[string]interface{}{
+						"Serializer": map[string]interface{}{"Type": "json"},
+						"Target":     tt.target,
+					},
+				},
+			}
+			config, err := convert(content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("convert = %+v, %v, want %q", config, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package glog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+//netConn 写入失败后自动重连的连接
+//不是线程安全的 manager保证Flush/Sync同一时刻只在1个routine中调用
+type netConn struct {
+	network   string //unixgram unix udp tcp tls
+	address   string
+	tlsConfig *tls.Config
+	timeout   time.Duration //连接以及每次写入的超时
+	retryMin  time.Duration //连接失败后的最小重试间隔
+	retryMax  time.Duration //重试间隔每次失败翻倍 最大为retryMax
+
+	conn       net.Conn
+	retryDelay time.Duration //下次连接失败后的重试间隔
+	nextDial   time.Time     //在此之前不会尝试连接
+	dialErr    error         //最近1次连接失败的错误
+	closed     bool          //shutdown之后不再连接
+}
+
+//errBackoff 连接失败后等待重试期间返回
+var errBackoff = errors.New("waiting to reconnect")
+
+//errConnClosed shutdown之后写入时返回
+var errConnClosed = errors.New("connection closed")
+
+func newNetConn(config map[string]interface{}, network string, address string) (*netConn, error) {
+	c := &netConn{
+		network:  configString(config, "Network", network),
+		address:  configString(config, "Address", address),
+		timeout:  configDuration(config, "Timeout", 5*time.Second),
+		retryMin: configDuration(config, "RetryMin", 100*time.Millisecond),
+		retryMax: configDuration(config, "RetryMax", 30*time.Second),
+	}
+	c.retryDelay = c.retryMin
+	if c.address == "" {
+		return nil, errors.New("empty address")
+	}
+	if c.network == "tls" {
+		tc, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		c.tlsConfig = tc
+	}
+	return c, nil
+}
+
+//newTLSConfig 支持CAFile ServerName InsecureSkipVerify
+func newTLSConfig(config map[string]interface{}) (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         configString(config, "ServerName", ""),
+		InsecureSkipVerify: configBool(config, "InsecureSkipVerify", false),
+	}
+	if caFile := configString(config, "CAFile", ""); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", caFile)
+		}
+		tc.RootCAs = pool
+	}
+	return tc, nil
+}
+
+//stream 是否是流式连接 流式连接需要分帧
+func (c *netConn) stream() bool {
+	return c.network == "tcp" || c.network == "tcp4" || c.network == "tcp6" ||
+		c.network == "tls" || c.network == "unix"
+}
+
+//waiting 是否在连接失败后等待重连 等待期间dial直接返回errBackoff
+func (c *netConn) waiting() bool {
+	return c.conn == nil && !c.closed && time.Now().Before(c.nextDial)
+}
+
+//dial 连接失败后按指数退避等待 等待期间返回errBackoff
+func (c *netConn) dial() error {
+	if c.conn != nil {
+		return nil
+	}
+	if c.closed {
+		return errConnClosed
+	}
+	if time.Now().Before(c.nextDial) {
+		return fmt.Errorf("%w: %v", errBackoff, c.dialErr)
+	}
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(c.network, c.address)
+	}
+	if err != nil {
+		c.dialErr = err
+		c.nextDial = time.Now().Add(c.retryDelay)
+		c.retryDelay *= 2
+		if c.retryDelay > c.retryMax {
+			c.retryDelay = c.retryMax
+		}
+		return err
+	}
+	c.conn = conn
+	c.retryDelay = c.retryMin
+	return nil
+}
+
+//write 没有连接时先建立连接 写入失败时关闭连接 下次write时立即重连
+func (c *netConn) write(b []byte) error {
+	if err := c.dial(); err != nil {
+		return err
+	}
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	_, err := c.conn.Write(b)
+	if err != nil {
+		c.close()
+	}
+	return err
+}
+
+func (c *netConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+//shutdown 关闭连接 之后不再重连 用于Target的Close
+func (c *netConn) shutdown() error {
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
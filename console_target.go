@@ -1,14 +1,41 @@
 package glog
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"sort"
+	"strings"
 )
 
+//每个级别的ANSI颜色
+var consoleColors = map[LogLevel]string{
+	TraceLevel: "\x1b[90m",
+	DebugLevel: "\x1b[36m",
+	InfoLevel:  "\x1b[32m",
+	WarnLevel:  "\x1b[33m",
+	ErrorLevel: "\x1b[31m",
+	PanicLevel: "\x1b[1;35m",
+	FatalLevel: "\x1b[1;35m",
+}
+
+const consoleColorReset = "\x1b[0m"
+
 //输出信息到console 使用log库来实现
 type consoleTarget struct {
-	name     string   //只读
-	minLevel LogLevel //只读
-	maxLevel LogLevel //只读
+	name      string      //只读
+	minLevel  LogLevel    //只读
+	maxLevel  LogLevel    //只读
+	logger    *log.Logger //只读
+	pretty    bool        //只读 忽略Serializer 输出对齐的 便于阅读的格式
+	color     bool        //只读 按级别着色 pretty时只着色级别和调用者
+	nameWidth int         //只读 pretty时Name列的宽度
+
+	splitLevel LogLevel    //只读 不为EveryLevel时 大于等于该级别的日志写入errLogger
+	errLogger  *log.Logger //只读 写入stderr
+	errColor   bool        //只读
 }
 
 func (ct *consoleTarget) Name() string {
@@ -23,13 +50,85 @@ func (ct *consoleTarget) MaxLevel() LogLevel {
 	return ct.maxLevel
 }
 
+//Write log.Logger保证1条日志只调用1次Write 多个routine同时写入时不会交错
 func (ct *consoleTarget) Write(event *LogEvent, sr Serializer) {
+	logger, color := ct.logger, ct.color
+	if ct.splitLevel != EveryLevel && event.Level >= ct.splitLevel {
+		logger, color = ct.errLogger, ct.errColor
+	}
+	if ct.pretty {
+		logger.Print(ct.format(event, color))
+		return
+	}
 	bs := sr.Encode(event)
-	if bs != nil {
-		log.Println(string(bs))
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	if color {
+		logger.Println(consoleColors[event.Level] + string(bs) + consoleColorReset)
 	} else {
-		log.Printf("%+v\r\n", event)
+		logger.Println(string(bs))
+	}
+}
+
+//format 生成便于阅读的多行文本
+func (ct *consoleTarget) format(e *LogEvent, color bool) string {
+	var buf bytes.Buffer
+	desc := e.LevelDesc
+	if desc == "" {
+		desc = levelName(e.Level)
+	}
+	buf.WriteString(eventTime(e).Format("2006-01-02 15:04:05.000"))
+	buf.WriteByte(' ')
+	if color {
+		buf.WriteString(consoleColors[e.Level])
+	}
+	fmt.Fprintf(&buf, "%-5s", desc)
+	if color {
+		buf.WriteString(consoleColorReset)
+	}
+	fmt.Fprintf(&buf, " %-*s ", ct.nameWidth, e.Name)
+	buf.WriteString(e.Message())
+	if e.Caller != nil {
+		buf.WriteString("  ")
+		if color {
+			buf.WriteString("\x1b[90m")
+		}
+		buf.WriteString(e.Caller.String())
+		if color {
+			buf.WriteString(consoleColorReset)
+		}
+	}
+	buf.WriteByte('\n')
+
+	keys := make([]string, 0, len(e.Properties)+1)
+	width := 0
+	for k := range e.Properties {
+		keys = append(keys, k)
+		if len(k) > width {
+			width = len(k)
+		}
+	}
+	sort.Strings(keys)
+	if e.Err != nil && width < len("error") {
+		width = len("error")
 	}
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "    %-*s  %s\n", width+1, k+":", indent(fmt.Sprintf("%+v", e.Properties[k]), width+7))
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&buf, "    %-*s  %s\n", width+1, "error:", indent(e.Err.Error(), width+7))
+	}
+	if e.StackTrace != "" {
+		buf.WriteString(indent("    "+strings.TrimRight(e.StackTrace, "\n"), 4))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+//indent 多行文本从第2行开始缩进n个空格
+func indent(s string, n int) string {
+	return strings.Replace(s, "\n", "\n"+strings.Repeat(" ", n), -1)
 }
 
 func (ct *consoleTarget) Overflow() bool {
@@ -40,6 +139,27 @@ func (ct *consoleTarget) Flush() {
 	return
 }
 
+//isTerminal 是否是终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+//useColor Color为always never auto auto时输出是终端并且没有设置NO_COLOR才着色
+func useColor(mode string, w io.Writer) bool {
+	if mode == "always" {
+		return true
+	}
+	if mode == "never" {
+		return false
+	}
+	return os.Getenv("NO_COLOR") == "" && isTerminal(w)
+}
+
 func createConsoleTarget(config map[string]interface{}) Target {
 	ct := &consoleTarget{}
 
@@ -62,5 +182,28 @@ func createConsoleTarget(config map[string]interface{}) Target {
 	} else {
 		ct.minLevel = toLevel(minLevel.(string))
 	}
+
+	//SplitLevel 大于等于该级别写入stderr 其他写入Output 此时Output默认为stdout
+	ct.splitLevel = toLevel(configString(config, "SplitLevel", ""))
+	output := "stderr"
+	if ct.splitLevel != EveryLevel {
+		output = "stdout"
+	}
+	var out io.Writer = os.Stderr
+	if configString(config, "Output", output) == "stdout" {
+		out = os.Stdout
+	}
+	//pretty自己输出时间 不使用log库的前缀
+	ct.pretty = configBool(config, "Pretty", false)
+	flags := 0
+	if configBool(config, "Prefix", true) && !ct.pretty {
+		flags = log.LstdFlags
+	}
+	color := configString(config, "Color", "auto")
+	ct.logger = log.New(out, "", flags)
+	ct.color = useColor(color, out)
+	ct.nameWidth = configInt(config, "NameWidth", 12)
+	ct.errLogger = log.New(os.Stderr, "", flags)
+	ct.errColor = useColor(color, os.Stderr)
 	return ct
 }
@@ -0,0 +1,124 @@
+package glog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//dedupRun 1个logger当前连续相同的日志
+type dedupRun struct {
+	locker  sync.Mutex
+	first   *LogEvent //protected by locker 为nil时没有等待输出的日志
+	key     string    //protected by locker
+	last    time.Time //protected by locker
+	count   int       //protected by locker
+	expires time.Time //protected by locker
+}
+
+//Deduper 把同一个logger在Window内连续相同的日志合并成1条 带repeat_count first_time last_time属性
+//相同是指级别 格式化后的消息 Properties以及错误都相同 Panic和Fatal不合并
+//日志会等到出现不同的日志或者Window到期时才输出
+type Deduper struct {
+	window time.Duration
+
+	locker sync.Mutex
+	runs   map[string]*dedupRun //protected by locker
+}
+
+//NewDeduper 创建Deduper 可以设置到LoggerConfig.Dedup
+func NewDeduper(window time.Duration) *Deduper {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &Deduper{
+		window: window,
+		runs:   make(map[string]*dedupRun),
+	}
+}
+
+func (d *Deduper) run(name string) *dedupRun {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	r := d.runs[name]
+	if r == nil {
+		r = &dedupRun{}
+		d.runs[name] = r
+	}
+	return r
+}
+
+//push 与上1条相同时合并 否则输出之前合并的日志 emit在run的锁内调用 保证同一个logger的顺序
+func (d *Deduper) push(e *LogEvent, emit func(e *LogEvent)) {
+	r := d.run(e.Name)
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	now := eventTime(e)
+	if e.Level >= PanicLevel {
+		r.finish(emit)
+		emit(e)
+		return
+	}
+	key := dedupKey(e)
+	if r.first != nil && r.key == key && now.Before(r.expires) {
+		r.count++
+		r.last = now
+		return
+	}
+	r.finish(emit)
+	r.first = e
+	r.key = key
+	r.last = now
+	r.count = 1
+	r.expires = now.Add(d.window)
+}
+
+//expire 输出Window到期的日志 force时全部输出
+func (d *Deduper) expire(force bool, emit func(e *LogEvent)) {
+	d.locker.Lock()
+	runs := make([]*dedupRun, 0, len(d.runs))
+	for _, r := range d.runs {
+		runs = append(runs, r)
+	}
+	d.locker.Unlock()
+	now := time.Now()
+	for _, r := range runs {
+		r.locker.Lock()
+		if r.first != nil && (force || !now.Before(r.expires)) {
+			r.finish(emit)
+		}
+		r.locker.Unlock()
+	}
+}
+
+//finish 输出等待中的日志 重复时复制1份并加上重复的次数以及第1条和最后1条的时间 protected by locker
+func (r *dedupRun) finish(emit func(e *LogEvent)) {
+	if r.first == nil {
+		return
+	}
+	e := r.first
+	if r.count > 1 {
+		merged := *e
+		merged.Properties = make(map[string]interface{}, len(e.Properties)+3)
+		for k, v := range e.Properties {
+			merged.Properties[k] = v
+		}
+		merged.Properties["repeat_count"] = r.count
+		merged.Properties["first_time"] = eventTime(e).Format(time.RFC3339Nano)
+		merged.Properties["last_time"] = r.last.Format(time.RFC3339Nano)
+		e = &merged
+	}
+	r.first = nil
+	r.count = 0
+	emit(e)
+}
+
+func dedupKey(e *LogEvent) string {
+	msg := e.Message()
+	errMsg := ""
+	if e.Err != nil {
+		errMsg = e.Err.Error()
+	}
+	//fmt输出map时按key排序
+	return fmt.Sprintf("%d\x00%s\x00%v\x00%s", e.Level, msg, e.Properties, errMsg)
+}
@@ -0,0 +1,149 @@
+package glog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dedupEvent(level LogLevel, msg string, ts time.Time) *LogEvent {
+	e := testEvent(level, "app", msg)
+	e.Timestamp = ts
+	return e
+}
+
+//describeEvents 消息以及repeat_count 便于比较
+func describeEvents(events []*LogEvent) string {
+	var parts []string
+	for _, e := range events {
+		s := e.Message()
+		if n, ok := e.Properties["repeat_count"]; ok {
+			s += fmt.Sprintf(" x%v", n)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "|")
+}
+
+func TestDeduperMerge(t *testing.T) {
+	d := NewDeduper(time.Hour)
+	var emitted []*LogEvent
+	emit := func(e *LogEvent) { emitted = append(emitted, e) }
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		d.push(dedupEvent(InfoLevel, "retrying", start.Add(time.Duration(i)*time.Second)), emit)
+	}
+	if len(emitted) != 0 {
+		t.Fatalf("duplicates should wait for a different event, got %s", describeEvents(emitted))
+	}
+	d.push(dedupEvent(InfoLevel, "connected", start.Add(3*time.Second)), emit)
+	if got := describeEvents(emitted); got != "retrying x3" {
+		t.Fatalf("got %s", got)
+	}
+	merged := emitted[0]
+	if merged.Properties["first_time"] != start.Format(time.RFC3339Nano) ||
+		merged.Properties["last_time"] != start.Add(2*time.Second).Format(time.RFC3339Nano) {
+		t.Fatalf("Properties = %v", merged.Properties)
+	}
+	d.expire(true, emit)
+	if got := describeEvents(emitted); got != "retrying x3|connected" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestDeduperKey(t *testing.T) {
+	d := NewDeduper(time.Hour)
+	var emitted []*LogEvent
+	emit := func(e *LogEvent) { emitted = append(emitted, e) }
+	now := time.Now()
+	warn := dedupEvent(WarnLevel, "retrying", now)
+	withProps := dedupEvent(WarnLevel, "retrying", now)
+	withProps.Properties = Properties{"attempt": 2}
+	//级别或者Properties不同时不合并
+	for _, e := range []*LogEvent{dedupEvent(InfoLevel, "retrying", now), warn, withProps, withProps} {
+		d.push(e, emit)
+	}
+	d.expire(true, emit)
+	if got := describeEvents(emitted); got != "retrying|retrying|retrying x2" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestDeduperWindow(t *testing.T) {
+	d := NewDeduper(50 * time.Millisecond)
+	var emitted []*LogEvent
+	emit := func(e *LogEvent) { emitted = append(emitted, e) }
+	start := time.Now()
+	d.push(dedupEvent(InfoLevel, "tick", start), emit)
+	d.push(dedupEvent(InfoLevel, "tick", start.Add(10*time.Millisecond)), emit)
+	d.expire(false, emit)
+	if len(emitted) != 0 {
+		t.Fatalf("expired before the window, got %s", describeEvents(emitted))
+	}
+	//Window之后相同的日志重新开始计数
+	d.push(dedupEvent(InfoLevel, "tick", start.Add(60*time.Millisecond)), emit)
+	if got := describeEvents(emitted); got != "tick x2" {
+		t.Fatalf("got %s", got)
+	}
+	time.Sleep(time.Until(start.Add(120 * time.Millisecond)))
+	d.expire(false, emit)
+	if got := describeEvents(emitted); got != "tick x2|tick" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestDeduperPanicFatal(t *testing.T) {
+	d := NewDeduper(time.Hour)
+	var emitted []*LogEvent
+	emit := func(e *LogEvent) { emitted = append(emitted, e) }
+	now := time.Now()
+	d.push(dedupEvent(ErrorLevel, "failed", now), emit)
+	d.push(dedupEvent(ErrorLevel, "failed", now), emit)
+	//Panic和Fatal先输出之前合并的日志 自己立即输出 不合并
+	for _, level := range []LogLevel{PanicLevel, PanicLevel, FatalLevel} {
+		d.push(dedupEvent(level, "failed", now), emit)
+	}
+	if got := describeEvents(emitted); got != "failed x2|failed|failed|failed" {
+		t.Fatalf("got %s", got)
+	}
+	if emitted[3].Level != FatalLevel {
+		t.Fatalf("Level = %d", emitted[3].Level)
+	}
+}
+
+func TestManagerDedup(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%v", async), func(t *testing.T) {
+			target := &eventTarget{targetFilter: newTargetFilter(nil)}
+			config := NewLogConfig()
+			config.Async = async
+			config.Loggers = map[string]*LoggerConfig{
+				"*": {Dedup: NewDeduper(time.Hour)},
+			}
+			config.Layouts = []*Layout{{Target: target, Serializer: messageSerializer{}}}
+			m := NewWithConfig(config)
+			logger := m.GetLogger("app")
+			for i := 0; i < 3; i++ {
+				logger.Info("retrying")
+			}
+			logger.Info("connected")
+			if err := m.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := describeEvents(target.received()); got != "retrying x3|connected" {
+				t.Fatalf("got %s", got)
+			}
+			//Close时输出等待中的日志
+			logger.Info("done")
+			logger.Info("done")
+			if err := m.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := describeEvents(target.received()); got != "retrying x3|connected|done x2" {
+				t.Fatalf("got %s", got)
+			}
+		})
+	}
+}
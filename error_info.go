@@ -0,0 +1,121 @@
+package glog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//ErrorInfo error的结构化描述 序列化时输出为error对象
+type ErrorInfo struct {
+	Message string       `json:"message"`
+	Type    string       `json:"type"`
+	Stack   string       `json:"stack,omitempty"` //error自带的堆栈 如pkg/errors
+	Chain   []*ErrorInfo `json:"chain,omitempty"` //errors.Unwrap或errors.Join包装的error
+}
+
+//maxErrorDepth 防止error链过深或者循环引用
+const maxErrorDepth = 32
+
+//NewErrorInfo 解析err 包括包装的error链以及堆栈
+func NewErrorInfo(err error) *ErrorInfo {
+	return newErrorInfo(err, 0)
+}
+
+func newErrorInfo(err error, depth int) *ErrorInfo {
+	if isNilError(err) {
+		return nil
+	}
+	if info, ok := err.(*ErrorInfo); ok {
+		return info
+	}
+	info := &ErrorInfo{
+		Message: err.Error(),
+		Type:    errorType(err),
+		Stack:   errorStack(err),
+	}
+	if depth >= maxErrorDepth {
+		return info
+	}
+	var causes []error
+	switch x := err.(type) {
+	case interface{ Unwrap() []error }:
+		causes = x.Unwrap()
+	case interface{ Unwrap() error }:
+		causes = []error{x.Unwrap()}
+	}
+	for _, cause := range causes {
+		if c := newErrorInfo(cause, depth+1); c != nil {
+			info.Chain = append(info.Chain, c)
+		}
+	}
+	return info
+}
+
+//Error 实现error 用于spool重放时还原LogEvent.Err
+func (e *ErrorInfo) Error() string {
+	return e.Message
+}
+
+//Unwrap 返回Chain 重放的error仍然可以遍历error链
+func (e *ErrorInfo) Unwrap() []error {
+	errs := make([]error, len(e.Chain))
+	for i, c := range e.Chain {
+		errs[i] = c
+	}
+	return errs
+}
+
+//StackTrace 返回原来error的堆栈
+func (e *ErrorInfo) StackTrace() string {
+	return e.Stack
+}
+
+//errorType 返回err的类型名 *ErrorInfo返回原来error的类型
+func errorType(err error) string {
+	if info, ok := err.(*ErrorInfo); ok {
+		return info.Type
+	}
+	return reflect.TypeOf(err).String()
+}
+
+//errorStack 读取error的StackTrace()方法
+//pkg/errors的StackTrace()返回errors.StackTrace 为了不依赖它 使用反射调用并用%+v格式化
+func errorStack(err error) (stack string) {
+	defer func() {
+		if e := recover(); e != nil {
+			stack = ""
+		}
+	}()
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	out := method.Call(nil)[0]
+	if out.Kind() == reflect.String {
+		return out.String()
+	}
+	return fmt.Sprintf("%+v", out.Interface())
+}
+
+//firstError 返回参数中的第1个error 忽略值为nil的指针等
+func firstError(args []interface{}) error {
+	for _, v := range args {
+		if err, ok := v.(error); ok && !isNilError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+//isNilError err为nil或者是值为nil的指针 map等 这时调用Error()可能panic
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+	v := reflect.ValueOf(err)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package glog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+type nilReceiverError struct {
+	msg string
+}
+
+func (e *nilReceiverError) Error() string {
+	return e.msg
+}
+
+func TestTypedNilError(t *testing.T) {
+	var typed *nilReceiverError
+	tests := []struct {
+		name string
+		args []interface{}
+		want bool
+	}{
+		{"typed nil", []interface{}{"failed", typed}, false},
+		{"typed nil before error", []interface{}{typed, &nilReceiverError{msg: "boom"}}, true},
+		{"no error", []interface{}{"failed", 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstError(tt.args) != nil; got != tt.want {
+				t.Fatalf("firstError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if info := NewErrorInfo(typed); info != nil {
+		t.Fatalf("NewErrorInfo(typed nil) = %+v", info)
+	}
+}
+
+func TestTypedNilErrorWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+	config := NewLogConfig()
+	config.Layouts = []*Layout{{
+		Target:     NewWriterTarget(&buf, WriterOptions{}),
+		Serializer: &JSONSerializer{},
+	}}
+	m := NewWithConfig(config)
+	defer m.Close(context.Background())
+
+	var typed *nilReceiverError
+	logger := m.GetLogger("test")
+	logger.Error("failed", typed)
+	logger.Err(typed).Error("failed")
+	m.WriteEvent(LogEvent{Level: ErrorLevel, Name: "test", Args: []interface{}{"failed"}, Err: typed})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if strings.Contains(line, `"error"`) {
+			t.Fatalf("typed nil error serialized: %s", line)
+		}
+	}
+}
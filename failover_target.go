@@ -0,0 +1,218 @@
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//failoverEvent 等待写入子Target的日志
+type failoverEvent struct {
+	event *LogEvent
+	sr    Serializer
+}
+
+//failoverChild 子Target以及它的健康状态 只在Sync中访问
+type failoverChild struct {
+	target    Target
+	healthy   bool
+	failures  int       //连续失败的次数
+	nextProbe time.Time //不健康时 下次检查的时间
+}
+
+//failoverTarget 按顺序写入第1个健康的子Target
+//子Target连续失败FailThreshold次后标记为不健康 之后每ProbeInterval检查1次 恢复后切换回去
+//子Target的Name MinLevel MaxLevel不起作用 由failover自身的配置过滤
+//子Target失败时日志由failover保留 实现了Retainer的子Target(如net http)自己保留的日志被丢弃
+type failoverTarget struct {
+	targetFilter
+	children      []*failoverChild
+	failThreshold int
+	probeInterval time.Duration
+	interval      time.Duration //只读 写入的时间间隔
+	cacheSize     int           //缓存的日志条数超过该值时写入
+	bufferSize    int           //所有子Target都失败时最多保留的日志条数
+
+	locker  *sync.Mutex
+	pending []failoverEvent //protected by locker
+
+	backlog       []failoverEvent //只在Sync中访问 写入失败等待重试的日志
+	nextWriteTime time.Time
+	dropped       uint64 //atomic
+}
+
+func (ft *failoverTarget) Write(event *LogEvent, sr Serializer) {
+	ft.TryWrite(event, sr)
+}
+
+//TryWrite 复制event 到Sync时才写入子Target
+func (ft *failoverTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	e := copyEvent(event)
+	ft.locker.Lock()
+	ft.pending = append(ft.pending, failoverEvent{event: &e, sr: sr})
+	ft.locker.Unlock()
+	return nil
+}
+
+func (ft *failoverTarget) Overflow() bool {
+	ft.locker.Lock()
+	size := len(ft.pending)
+	ft.locker.Unlock()
+	return time.Now().After(ft.nextWriteTime) || size >= ft.cacheSize
+}
+
+func (ft *failoverTarget) Flush() {
+	ft.Sync()
+}
+
+//Sync 把缓存的日志写入第1个健康的子Target 失败时依次尝试下一个
+func (ft *failoverTarget) Sync() error {
+	ft.locker.Lock()
+	pending := ft.pending
+	ft.pending = nil
+	ft.locker.Unlock()
+	ft.nextWriteTime = time.Now().Add(ft.interval)
+
+	ft.probe()
+	batch := append(ft.backlog, pending...)
+	ft.backlog = nil
+	var errs []error
+	for i, child := range ft.children {
+		if !child.healthy {
+			continue
+		}
+		err := ft.writeChild(child, batch)
+		if err == nil {
+			child.failures = 0
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("child %d: %w", i, err))
+		child.failures++
+		if child.failures >= ft.failThreshold {
+			child.healthy = false
+			child.nextProbe = time.Now().Add(ft.probeInterval)
+		}
+	}
+	//全部失败 保留最近的bufferSize条等待下次写入
+	if len(batch) > ft.bufferSize {
+		atomic.AddUint64(&ft.dropped, uint64(len(batch)-ft.bufferSize))
+		batch = batch[len(batch)-ft.bufferSize:]
+	}
+	ft.backlog = batch
+	if len(errs) == 0 {
+		return errors.New("failover: no healthy target")
+	}
+	return errors.Join(errs...)
+}
+
+//probe 只检查到期的不健康子Target 没有实现Prober的直接恢复 由下次写入验证
+func (ft *failoverTarget) probe() {
+	now := time.Now()
+	for _, child := range ft.children {
+		if child.healthy || now.Before(child.nextProbe) {
+			continue
+		}
+		if p, ok := child.target.(Prober); ok {
+			if err := p.Probe(); err != nil {
+				child.nextProbe = now.Add(ft.probeInterval)
+				continue
+			}
+		}
+		child.healthy = true
+		child.failures = 0
+	}
+}
+
+//writeChild 失败时丢弃子Target自己保留的日志 由failover保留并重试
+func (ft *failoverTarget) writeChild(child *failoverChild, batch []failoverEvent) error {
+	err := ft.writeBatch(child.target, batch)
+	if r, ok := child.target.(Retainer); ok && err != nil {
+		r.Discard()
+	}
+	return err
+}
+
+func (ft *failoverTarget) writeBatch(target Target, batch []failoverEvent) error {
+	t, ok := target.(ErrorTarget)
+	for _, v := range batch {
+		if ok {
+			if err := t.TryWrite(v.event, v.sr); err != nil {
+				return err
+			}
+		} else {
+			target.Write(v.event, v.sr)
+		}
+	}
+	if s, ok := target.(Syncer); ok {
+		return s.Sync()
+	}
+	target.Flush()
+	return nil
+}
+
+//Close 关闭所有子Target
+func (ft *failoverTarget) Close() error {
+	var errs []error
+	for _, child := range ft.children {
+		if err := closeTarget(child.target); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (ft *failoverTarget) TargetStats() TargetStats {
+	stats := TargetStats{
+		Dropped: atomic.LoadUint64(&ft.dropped),
+	}
+	for _, child := range ft.children {
+		if t, ok := child.target.(StatsTarget); ok {
+			ts := t.TargetStats()
+			stats.BytesWritten += ts.BytesWritten
+			stats.Rotations += ts.Rotations
+			stats.Dropped += ts.Dropped
+		}
+	}
+	return stats
+}
+
+func createFailoverTarget(config map[string]interface{}) Target {
+	ft := &failoverTarget{
+		targetFilter:  newTargetFilter(config),
+		failThreshold: configInt(config, "FailThreshold", 1),
+		probeInterval: configDuration(config, "ProbeInterval", 30*time.Second),
+		interval:      configDuration(config, "Interval", time.Second),
+		cacheSize:     configInt(config, "CacheSize", 1000),
+		bufferSize:    configInt(config, "BufferSize", 10000),
+		locker:        &sync.Mutex{},
+	}
+	targets, _ := config["Targets"].([]interface{})
+	for _, v := range targets {
+		tt, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		target := findTarget(configString(tt, "Type", ""), tt)
+		if target == nil {
+			//子Target创建失败时failover也失败 由加载配置报告
+			log.Println("createFailoverTarget: create", configString(tt, "Type", ""), "target failed")
+			for _, child := range ft.children {
+				closeTarget(child.target)
+			}
+			return nil
+		}
+		ft.children = append(ft.children, &failoverChild{
+			target:  target,
+			healthy: true,
+		})
+	}
+	if len(ft.children) == 0 {
+		log.Println("createFailoverTarget: no Targets")
+		return nil
+	}
+	ft.nextWriteTime = time.Now().Add(ft.interval)
+	return ft
+}
@@ -0,0 +1,131 @@
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//retainingTarget 像net一样Sync失败时保留日志 之后的Sync重试
+type retainingTarget struct {
+	targetFilter
+	down      bool
+	probes    int
+	discards  int
+	pending   []string
+	delivered []string
+}
+
+func (rt *retainingTarget) Write(event *LogEvent, sr Serializer) {
+	rt.pending = append(rt.pending, string(sr.Encode(event)))
+}
+
+func (rt *retainingTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	rt.Write(event, sr)
+	return nil
+}
+
+func (rt *retainingTarget) Overflow() bool {
+	return false
+}
+
+func (rt *retainingTarget) Flush() {
+	rt.Sync()
+}
+
+func (rt *retainingTarget) Sync() error {
+	if rt.down {
+		return errors.New("down")
+	}
+	rt.delivered = append(rt.delivered, rt.pending...)
+	rt.pending = nil
+	return nil
+}
+
+func (rt *retainingTarget) Probe() error {
+	rt.probes++
+	if rt.down {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func (rt *retainingTarget) Discard() {
+	rt.discards++
+	rt.pending = nil
+}
+
+func TestFailoverTarget(t *testing.T) {
+	primary, secondary := &retainingTarget{}, &retainingTarget{}
+	ft := &failoverTarget{
+		children: []*failoverChild{
+			{target: primary, healthy: true},
+			{target: secondary, healthy: true},
+		},
+		failThreshold: 1,
+		probeInterval: 20 * time.Millisecond,
+		bufferSize:    100,
+		locker:        &sync.Mutex{},
+	}
+	write := func(msgs ...string) {
+		for _, msg := range msgs {
+			ft.TryWrite(testEvent(InfoLevel, "app", msg), messageSerializer{})
+		}
+		if err := ft.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a")
+	//健康时不调用Probe
+	if primary.probes != 0 || !reflect.DeepEqual(primary.delivered, []string{"a"}) {
+		t.Fatalf("probes = %d delivered = %v", primary.probes, primary.delivered)
+	}
+
+	primary.down = true
+	write("b", "c")
+	if primary.discards != 1 || !reflect.DeepEqual(secondary.delivered, []string{"b", "c"}) {
+		t.Fatalf("discards = %d secondary = %v", primary.discards, secondary.delivered)
+	}
+
+	primary.down = false
+	time.Sleep(30 * time.Millisecond)
+	write("d")
+	//恢复后不会重新发送已经交给secondary的日志
+	if primary.probes != 1 || !reflect.DeepEqual(primary.delivered, []string{"a", "d"}) {
+		t.Fatalf("probes = %d delivered = %v", primary.probes, primary.delivered)
+	}
+}
+
+func TestFailoverTargetCopiesEvent(t *testing.T) {
+	child := &retainingTarget{}
+	ft := &failoverTarget{
+		children:      []*failoverChild{{target: child, healthy: true}},
+		failThreshold: 1,
+		bufferSize:    100,
+		locker:        &sync.Mutex{},
+	}
+	e := testEvent(InfoLevel, "app", "")
+	e.Format, e.Args = "user=%s", []interface{}{"alice"}
+	e.Properties = Properties{"user": "alice"}
+	ft.TryWrite(e, propertySerializer{})
+	//Sync之前修改不影响已经写入的日志
+	e.Properties["user"] = "bob"
+	e.Args[0] = "bob"
+	if err := ft.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"user=alice alice"}; !reflect.DeepEqual(child.delivered, want) {
+		t.Fatalf("delivered = %v, want %v", child.delivered, want)
+	}
+}
+
+//propertySerializer 输出消息和user属性
+type propertySerializer struct{}
+
+func (propertySerializer) Encode(e *LogEvent) []byte {
+	return []byte(fmt.Sprint(e.Message(), " ", e.Properties["user"]))
+}
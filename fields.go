@@ -0,0 +1,95 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+//FieldFunc LogConfig.Fields中的动态字段 每条日志调用1次
+type FieldFunc func() interface{}
+
+//dynamicFields 可以在DynamicFields中使用的内置字段 返回字段的值或者FieldFunc
+var dynamicFields = map[string]func() interface{}{
+	"hostname": func() interface{} {
+		hostname, _ := os.Hostname()
+		return hostname
+	},
+	"pid": func() interface{} {
+		return os.Getpid()
+	},
+	"go_version": func() interface{} {
+		return runtime.Version()
+	},
+	"build_commit": func() interface{} {
+		return buildCommit()
+	},
+	"goroutine_id": func() interface{} {
+		return FieldFunc(goroutineID)
+	},
+}
+
+//buildCommit 编译时记录的vcs.revision 无法获取时返回空
+func buildCommit() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, v := range info.Settings {
+			if v.Key == "vcs.revision" {
+				return v.Value
+			}
+		}
+	}
+	return ""
+}
+
+//goroutineID 从runtime.Stack的第1行"goroutine 18 [running]:"中读取
+func goroutineID() interface{} {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	b := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+//mergeFields 返回合并后的Properties 日志自身的Properties优先 不修改原来的map
+func mergeFields(fields map[string]interface{}, props map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(fields)+len(props))
+	for k, v := range fields {
+		if f, ok := v.(FieldFunc); ok {
+			v = f()
+		}
+		merged[k] = v
+	}
+	for k, v := range props {
+		merged[k] = v
+	}
+	return merged
+}
+
+//parseFields 解析Fields和DynamicFields 字符串中的${ENV}替换为环境变量
+func parseFields(static map[string]interface{}, dynamic []interface{}) (map[string]interface{}, error) {
+	if len(static) == 0 && len(dynamic) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]interface{}, len(static)+len(dynamic))
+	for _, v := range dynamic {
+		name, _ := v.(string)
+		f, ok := dynamicFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown dynamic field %v", v)
+		}
+		fields[name] = f()
+	}
+	for k, v := range static {
+		if s, ok := v.(string); ok {
+			v = os.ExpandEnv(s)
+		}
+		fields[k] = v
+	}
+	return fields, nil
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,8 +30,13 @@ type fileTarget struct {
 	locker        *sync.Mutex
 	currLogBuff   int             //protected by locker
 	logBuf        [2]bytes.Buffer //protected by locker
+	logCount      [2]int          //protected by locker 每个buffer中的事件数
 	currCacheSize int             //protected by locker 当前buffer中的大小
 
+	bytesWritten uint64 //atomic
+	rotations    uint64 //atomic
+	dropped      uint64 //atomic 写入失败丢弃的事件数
+
 	nextWriteTime time.Time
 	lastPCDate    string
 }
@@ -48,6 +54,11 @@ func (ft *fileTarget) MaxLevel() LogLevel {
 }
 
 func (ft *fileTarget) Write(event *LogEvent, sr Serializer) {
+	ft.TryWrite(event, sr)
+}
+
+//TryWrite 只写入缓存 错误在Sync时返回
+func (ft *fileTarget) TryWrite(event *LogEvent, sr Serializer) error {
 	bs := sr.Encode(event)
 	if bs == nil {
 		bs = []byte(fmt.Sprintf("%+v", event))
@@ -59,8 +70,9 @@ func (ft *fileTarget) Write(event *LogEvent, sr Serializer) {
 	ft.logBuf[index].Write(bs)
 	ft.logBuf[index].WriteByte('\r')
 	ft.logBuf[index].WriteByte('\n')
+	ft.logCount[index]++
 	ft.currCacheSize += len(bs) + 2
-
+	return nil
 }
 
 func (ft *fileTarget) Overflow() bool {
@@ -70,10 +82,17 @@ func (ft *fileTarget) Overflow() bool {
 }
 
 func (ft *fileTarget) Flush() {
+	ft.Sync()
+}
+
+func (ft *fileTarget) Sync() (err error) {
 	//写入日志文件
 	var cache *bytes.Buffer
 	ft.locker.Lock()
-	cache = &ft.logBuf[ft.currLogBuff%len(ft.logBuf)]
+	index := ft.currLogBuff % len(ft.logBuf)
+	cache = &ft.logBuf[index]
+	count := ft.logCount[index]
+	ft.logCount[index] = 0
 	ft.currLogBuff = (ft.currLogBuff + 1) % len(ft.logBuf)
 	ft.currCacheSize = 0
 
@@ -81,14 +100,48 @@ func (ft *fileTarget) Flush() {
 	if cache.Len() > 0 {
 		//写入日志文件
 		ft.createLogFile()
-		ft.currLogSize += int64(ft.writeFromCache(cache))
+		var n int
+		n, err = ft.writeFromCache(cache)
+		ft.currLogSize += int64(n)
+		atomic.AddUint64(&ft.bytesWritten, uint64(n))
+		if err != nil {
+			atomic.AddUint64(&ft.dropped, uint64(count))
+		}
 	}
 	// nextWritetime 是一个结构 Overflow里读 Flush里写 如果 两个函数不在一个线程会出问题
 	//目前为止manager保证了 overflow和flush会在一个线程调用
 	ft.nextWriteTime = time.Now().Add(ft.interval)
+	return err
+}
+
+//Probe 检查日志目录是否可写
+func (ft *fileTarget) Probe() error {
+	if err := os.MkdirAll(ft.root, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(ft.root, ".probe-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (ft *fileTarget) TargetStats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&ft.bytesWritten),
+		Rotations:    atomic.LoadUint64(&ft.rotations),
+		Dropped:      atomic.LoadUint64(&ft.dropped),
+	}
 }
 
 func (ft *fileTarget) createLogFile() {
+	lastLogFileName := ft.fullLogFileName
+	defer func() {
+		if lastLogFileName != "" && lastLogFileName != ft.fullLogFileName {
+			atomic.AddUint64(&ft.rotations, 1)
+		}
+	}()
 	currPCDate := getShortDate()
 	if ft.fullLogFileName != "" && ft.currLogSize >= ft.volumeSize {
 		//文件超过允许的大小 写入到新文件中去
@@ -126,22 +179,21 @@ func getShortDate() string {
 	return time.Now().Format("2006-01-02")
 }
 
-func (ft *fileTarget) writeFromCache(logs *bytes.Buffer) (size int) {
+func (ft *fileTarget) writeFromCache(logs *bytes.Buffer) (size int, e error) {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println("writeFromCache 0:", ft.fullLogFileName, ":", err)
 			size = 0
+			e = fmt.Errorf("write %s: %+v", ft.fullLogFileName, err)
 		}
 	}()
 	if logs.Len() <= 0 {
-		return 0
+		return 0, nil
 	}
 	defer logs.Reset()
 
 	f, err := os.OpenFile(ft.fullLogFileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.ModePerm)
 	if err != nil {
-		log.Println("writeFromCache 1:", ft.fullLogFileName, ":", err)
-		return 0
+		return 0, err
 	}
 	defer f.Close()
 	n, err := f.Write(logs.Bytes())
@@ -149,10 +201,9 @@ func (ft *fileTarget) writeFromCache(logs *bytes.Buffer) (size int) {
 		err = f.Sync()
 	}
 	if err != nil {
-		log.Println("writeFromCache 2:", ft.fullLogFileName, ":", err)
-		return 0
+		return 0, err
 	}
-	return n
+	return n, nil
 }
 
 func createFileTarget(config map[string]interface{}) Target {
@@ -0,0 +1,489 @@
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Filter 编译后的过滤表达式 可以同时在多个routine中使用
+//表达式如 level >= Warn && props.tenant == "acme" && !msg.contains("healthz")
+//字段: level name msg err props.X 级别可以直接写Trace Debug Info Warn Error Panic Fatal
+//运算符: && || ! == != < <= > >= () 字符串方法: contains startsWith endsWith matches(正则)
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+//CompileFilter 编译过滤表达式
+func CompileFilter(expr string) (*Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+//Match 日志是否满足表达式
+func (f *Filter) Match(e *LogEvent) bool {
+	return truthy(f.root.eval(&filterContext{event: e}))
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+//filterContext 1次求值的上下文 msg只格式化1次
+type filterContext struct {
+	event *LogEvent
+	msg   *string
+}
+
+func (c *filterContext) message() string {
+	if c.msg == nil {
+		s := c.event.Message()
+		c.msg = &s
+	}
+	return *c.msg
+}
+
+//filterNode 表达式树的节点 求值结果为 bool string float64 LogLevel 或者nil
+type filterNode interface {
+	eval(c *filterContext) interface{}
+}
+
+type filterLiteral struct {
+	value interface{}
+}
+
+func (n *filterLiteral) eval(c *filterContext) interface{} {
+	return n.value
+}
+
+//filterField level name msg err props.X
+type filterField struct {
+	name string
+	prop string
+}
+
+func (n *filterField) eval(c *filterContext) interface{} {
+	e := c.event
+	switch n.name {
+	case "level":
+		return e.Level
+	case "name":
+		return e.Name
+	case "msg":
+		return c.message()
+	case "err":
+		if e.Err == nil {
+			return nil
+		}
+		return e.Err.Error()
+	}
+	v, ok := e.Properties[n.prop]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+type filterNot struct {
+	x filterNode
+}
+
+func (n *filterNot) eval(c *filterContext) interface{} {
+	return !truthy(n.x.eval(c))
+}
+
+//filterLogic && ||
+type filterLogic struct {
+	and  bool
+	x, y filterNode
+}
+
+func (n *filterLogic) eval(c *filterContext) interface{} {
+	if n.and {
+		return truthy(n.x.eval(c)) && truthy(n.y.eval(c))
+	}
+	return truthy(n.x.eval(c)) || truthy(n.y.eval(c))
+}
+
+type filterCompare struct {
+	op   string
+	x, y filterNode
+}
+
+func (n *filterCompare) eval(c *filterContext) interface{} {
+	return compareValues(n.op, n.x.eval(c), n.y.eval(c))
+}
+
+//filterMethod msg.contains("x")等字符串方法 接收者不是字符串时为false
+type filterMethod struct {
+	name string
+	recv filterNode
+	arg  string
+	re   *regexp.Regexp
+}
+
+func (n *filterMethod) eval(c *filterContext) interface{} {
+	v := n.recv.eval(c)
+	if v == nil {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, n.arg)
+	case "startsWith":
+		return strings.HasPrefix(s, n.arg)
+	case "endsWith":
+		return strings.HasSuffix(s, n.arg)
+	}
+	return n.re.MatchString(s)
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case float64:
+		return t != 0
+	}
+	return true
+}
+
+//toFloat Properties中的数字可能是各种整数类型
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int8:
+		return float64(t), true
+	case int16:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case uint:
+		return float64(t), true
+	case uint8:
+		return float64(t), true
+	case uint16:
+		return float64(t), true
+	case uint32:
+		return float64(t), true
+	case uint64:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+//filterLevel 把字符串或者数字转换成级别 级别名不区分大小写
+func filterLevel(v interface{}) (LogLevel, bool) {
+	switch t := v.(type) {
+	case LogLevel:
+		return t, true
+	case string:
+		l := parseLevelName(t)
+		return l, l != EveryLevel
+	}
+	if f, ok := toFloat(v); ok {
+		return LogLevel(f), true
+	}
+	return EveryLevel, false
+}
+
+func parseLevelName(s string) LogLevel {
+	if s == "" {
+		return EveryLevel
+	}
+	s = strings.ToLower(s)
+	return toLevel(strings.ToUpper(s[:1]) + s[1:])
+}
+
+func compareValues(op string, x, y interface{}) bool {
+	_, xl := x.(LogLevel)
+	_, yl := y.(LogLevel)
+	if xl || yl {
+		a, ok1 := filterLevel(x)
+		b, ok2 := filterLevel(y)
+		if ok1 && ok2 {
+			return compareOrdered(op, float64(a), float64(b))
+		}
+		return op == "!="
+	}
+	if a, ok := toFloat(x); ok {
+		if b, ok := toFloat(y); ok {
+			return compareOrdered(op, a, b)
+		}
+	}
+	if x == nil || y == nil {
+		if op == "==" {
+			return x == nil && y == nil
+		}
+		return op == "!=" && (x != nil || y != nil)
+	}
+	if a, ok := x.(bool); ok {
+		b, ok := y.(bool)
+		if op == "==" {
+			return ok && a == b
+		}
+		return op == "!=" && (!ok || a != b)
+	}
+	a, ok1 := x.(string)
+	b, ok2 := y.(string)
+	if !ok1 {
+		a = fmt.Sprint(x)
+	}
+	if !ok2 {
+		b = fmt.Sprint(y)
+	}
+	return compareOrdered(op, float64(strings.Compare(a, b)), 0)
+}
+
+func compareOrdered(op string, a, b float64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+type filterToken struct {
+	kind byte //i:标识符 s:字符串 n:数字 o:运算符
+	text string
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(expr) && expr[j] != c {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, errors.New("unterminated string")
+			}
+			s := expr[i+1 : j]
+			if c == '"' {
+				v, err := strconv.Unquote(expr[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s", expr[i:j+1])
+				}
+				s = v
+			}
+			tokens = append(tokens, filterToken{kind: 's', text: s})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			j := i + 1
+			for j < len(expr) && (expr[j] >= '0' && expr[j] <= '9' || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: 'n', text: expr[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || expr[j] == '.' || expr[j] == '-' ||
+				expr[j] >= 'a' && expr[j] <= 'z' || expr[j] >= 'A' && expr[j] <= 'Z' || expr[j] >= '0' && expr[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: 'i', text: expr[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, v := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ","} {
+				if strings.HasPrefix(expr[i:], v) {
+					op = v
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			tokens = append(tokens, filterToken{kind: 'o', text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == 'o' && p.tokens[p.pos].text == op
+}
+
+func (p *filterParser) expect(op string) error {
+	if !p.peek(op) {
+		return fmt.Errorf("expected %q", op)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.peek("||") {
+		p.pos++
+		var y filterNode
+		y, err = p.parseAnd()
+		x = &filterLogic{x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	x, err := p.parseUnary()
+	for err == nil && p.peek("&&") {
+		p.pos++
+		var y filterNode
+		y, err = p.parseUnary()
+		x = &filterLogic{and: true, x: x, y: y}
+	}
+	return x, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.peek("!") {
+		p.pos++
+		x, err := p.parseUnary()
+		return &filterNot{x: x}, err
+	}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.peek(op) {
+			p.pos++
+			y, err := p.parsePrimary()
+			return &filterCompare{op: op, x: x, y: y}, err
+		}
+	}
+	return x, nil
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end")
+	}
+	if p.peek("(") {
+		p.pos++
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case 's':
+		return &filterLiteral{value: t.text}, nil
+	case 'n':
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		return &filterLiteral{value: f}, nil
+	case 'o':
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	if p.peek("(") {
+		return p.parseMethod(t.text)
+	}
+	return parseIdent(t.text)
+}
+
+//parseMethod 标识符的最后1段是方法名 参数只能是1个字符串
+func (p *filterParser) parseMethod(ident string) (filterNode, error) {
+	dot := strings.LastIndex(ident, ".")
+	if dot < 0 {
+		return nil, fmt.Errorf("unknown function %s", ident)
+	}
+	m := &filterMethod{name: ident[dot+1:]}
+	switch m.name {
+	case "contains", "startsWith", "endsWith", "matches":
+	default:
+		return nil, fmt.Errorf("unknown method %s", m.name)
+	}
+	recv, err := parseIdent(ident[:dot])
+	if err != nil {
+		return nil, err
+	}
+	m.recv = recv
+	p.pos++
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != 's' {
+		return nil, fmt.Errorf("%s expects a string argument", m.name)
+	}
+	m.arg = p.tokens[p.pos].text
+	p.pos++
+	if m.name == "matches" {
+		if m.re, err = regexp.Compile(m.arg); err != nil {
+			return nil, err
+		}
+	}
+	return m, p.expect(")")
+}
+
+func parseIdent(ident string) (filterNode, error) {
+	switch ident {
+	case "level", "name", "msg", "err":
+		return &filterField{name: ident}, nil
+	case "true":
+		return &filterLiteral{value: true}, nil
+	case "false":
+		return &filterLiteral{value: false}, nil
+	case "nil", "null":
+		return &filterLiteral{}, nil
+	}
+	if strings.HasPrefix(ident, "props.") && len(ident) > len("props.") {
+		return &filterField{name: "props", prop: ident[len("props."):]}, nil
+	}
+	if l := parseLevelName(ident); l != EveryLevel {
+		return &filterLiteral{value: l}, nil
+	}
+	return nil, fmt.Errorf("unknown identifier %s", ident)
+}
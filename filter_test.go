@@ -0,0 +1,140 @@
+package glog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func filterTestEvent() *LogEvent {
+	e := testEvent(WarnLevel, "db", "")
+	e.Format, e.Args = "slow query on %s", []interface{}{"users"}
+	e.Err = errors.New("timeout")
+	e.Properties = Properties{
+		"tenant": "acme",
+		"rows":   42,
+		"ratio":  int64(3),
+		"ok":     true,
+		"path":   `C:\tmp`,
+		"quote":  `say "hi"`,
+		"tab":    "a\tb",
+	}
+	return e
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		//&& 优先于 || ! 优先于 && 括号改变优先级
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!!true", true},
+		{`name == "api" || name == "db" && level >= Error`, false},
+		{`(name == "api" || name == "db") && level >= Warn`, true},
+
+		//级别 级别名不区分大小写 也可以是字符串
+		{"level >= Warn", true},
+		{"level > Warn", false},
+		{"level >= Error", false},
+		{"level == warn", true},
+		{"level != Info", true},
+		{`level < "Error"`, true},
+		{`level == "unknown"`, false},
+		{`level != "unknown"`, true},
+
+		//字符串以及转义
+		{`msg == "slow query on users"`, true},
+		{`props.path == "C:\\tmp"`, true},
+		{`props.quote == "say \"hi\""`, true},
+		{`props.quote == 'say "hi"'`, true},
+		{`props.tab == "a\tb"`, true},
+		{`name < "e"`, true},
+
+		//数字以及bool
+		{"props.rows > 40 && props.rows <= 42", true},
+		{"props.ratio == 3", true},
+		{"props.rows == -42", false},
+		{"props.ok == true", true},
+		{"props.ok != false", true},
+
+		//字符串方法 接收者不是字符串时使用fmt.Sprint
+		{`msg.contains("query")`, true},
+		{`msg.startsWith("slow")`, true},
+		{`msg.endsWith("users")`, true},
+		{`msg.matches("^slow .* users$")`, true},
+		{`name.contains("x")`, false},
+		{`err.contains("time")`, true},
+		{`props.rows.startsWith("4")`, true},
+		{`props.tenant.matches("^ac")`, true},
+
+		//不存在的属性为nil
+		{"props.missing == nil", true},
+		{`props.missing != "x"`, true},
+		{`props.missing == ""`, false},
+		{"props.missing > 1", false},
+		{`props.missing.contains("a")`, false},
+		{"!props.missing", true},
+		{"err != nil", true},
+	}
+	e := filterTestEvent()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := CompileFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Match(e); got != tt.want {
+				t.Fatalf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterNoError(t *testing.T) {
+	f, err := CompileFilter(`err == nil && !err.contains("timeout")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(testEvent(InfoLevel, "app", "hello")) {
+		t.Fatal("event without error should match")
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`msg == "abc`, "unterminated string"},
+		{`msg == 'abc`, "unterminated string"},
+		{`msg == "\q"`, "invalid string"},
+		{"level >= Warn Error", `unexpected "Error"`},
+		{"level >= Warn)", `unexpected ")"`},
+		{"foo == 1", "unknown identifier foo"},
+		{"props. == 1", "unknown identifier props."},
+		{`msg.upper("a")`, "unknown method upper"},
+		{`contains("a")`, "unknown function contains"},
+		{`msg.contains(1)`, "expects a string argument"},
+		{`msg.matches("(")`, "missing closing )"},
+		{"(level >= Warn", `expected ")"`},
+		{"level >=", "unexpected end"},
+		{"&& true", `unexpected "&&"`},
+		{"level # 1", `unexpected '#'`},
+		{"", "unexpected end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := CompileFilter(tt.expr)
+			if err == nil {
+				t.Fatalf("CompileFilter = %v, want error", f)
+			}
+			if !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), "filter ") {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package glog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//GELF UDP分块的格式 2字节魔数 8字节消息ID 1字节序号 1字节总数
+const (
+	gelfChunkHeaderSize = 12
+	gelfMaxChunks       = 128
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+//errGELFTooLarge udp时消息超过128块 重试也不会成功
+var errGELFTooLarge = errors.New("gelf message too large")
+
+//gelfHost GELFSerializer没有指定Host时使用 只获取1次
+var (
+	gelfHostOnce sync.Once
+	gelfHost     string
+)
+
+func gelfHostname() string {
+	gelfHostOnce.Do(func() {
+		gelfHost, _ = os.Hostname()
+	})
+	return gelfHost
+}
+
+//gelfFieldName 附加字段名只能包含字母 数字 下划线 点 减号
+var gelfFieldName = regexp.MustCompile(`[^\w\.\-]`)
+
+//GELFSerializer 输出Graylog的GELF 1.1 JSON Properties作为以_开头的附加字段
+type GELFSerializer struct {
+	Host string //为空时使用os.Hostname 只获取1次
+}
+
+//Encode 实现Serialization
+func (gs *GELFSerializer) Encode(e *LogEvent) []byte {
+	host := gs.Host
+	if host == "" {
+		host = gelfHostname()
+	}
+	msg := e.Message()
+	t := eventTime(e)
+	fields := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": msg,
+		"timestamp":     float64(t.UnixNano()/int64(time.Millisecond)) / 1000,
+		"level":         syslogSeverity(e.Level),
+	}
+	if e.StackTrace != "" {
+		fields["full_message"] = msg + "\n" + e.StackTrace
+	}
+	for k, v := range e.Properties {
+		name := "_" + gelfFieldName.ReplaceAllString(k, "_")
+		if name == "_id" {
+			//_id是保留字段
+			name = "_id_"
+		}
+		fields[name] = gelfValue(v)
+	}
+	if e.Name != "" {
+		fields["_logger"] = e.Name
+	}
+	if e.Err != nil {
+		fields["_error"] = e.Err.Error()
+		fields["_error_type"] = errorType(e.Err)
+	}
+	if e.Caller != nil {
+		fields["_file"] = e.Caller.File
+		fields["_line"] = e.Caller.Line
+		fields["_function"] = e.Caller.Function
+	}
+	bs, err := json.Marshal(fields)
+	if err != nil {
+		fmt.Println("GELFSerializer:", err)
+		return nil
+	}
+	return bs
+}
+
+//gelfValue 附加字段只能是字符串或者数字
+func gelfValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string, float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+//gelfTarget 通过udp或者tcp发送GELF消息 需要使用gelf序列化
+//udp时可以gzip压缩 超过ChunkSize的消息分块发送 最多128块 tcp时以\0分帧 不压缩
+type gelfTarget struct {
+	targetFilter
+	conn      *netConn
+	compress  bool          //udp时gzip压缩
+	chunkSize int           //udp时每个数据报的最大字节数 包括分块头
+	interval  time.Duration //只读 写入的时间间隔
+	cacheSize int           //缓存的字节数超过该值时写入
+
+	locker      *sync.Mutex
+	pending     [][]byte //protected by locker
+	pendingSize int      //protected by locker
+
+	nextWriteTime time.Time
+	dropped       uint64 //atomic
+	bytesWritten  uint64 //atomic
+}
+
+func (gt *gelfTarget) Write(event *LogEvent, sr Serializer) {
+	gt.TryWrite(event, sr)
+}
+
+func (gt *gelfTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		return fmt.Errorf("encode event failed")
+	}
+	gt.locker.Lock()
+	gt.pending = append(gt.pending, bs)
+	gt.pendingSize += len(bs)
+	gt.locker.Unlock()
+	return nil
+}
+
+func (gt *gelfTarget) Overflow() bool {
+	gt.locker.Lock()
+	size := gt.pendingSize
+	gt.locker.Unlock()
+	return time.Now().After(gt.nextWriteTime) || size >= gt.cacheSize
+}
+
+func (gt *gelfTarget) Flush() {
+	gt.Sync()
+}
+
+//Sync 发送所有缓存的消息 写入失败时重连1次 仍然失败则丢弃剩余的消息
+//udp时太大的消息丢弃并返回错误 继续发送后面的消息
+func (gt *gelfTarget) Sync() error {
+	gt.locker.Lock()
+	pending := gt.pending
+	gt.pending = nil
+	gt.pendingSize = 0
+	gt.locker.Unlock()
+	gt.nextWriteTime = time.Now().Add(gt.interval)
+
+	var errs []error
+	for i, msg := range pending {
+		err := gt.send(msg)
+		if errors.Is(err, errGELFTooLarge) {
+			atomic.AddUint64(&gt.dropped, 1)
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			//连接已经关闭 write会重新连接
+			err = gt.send(msg)
+		}
+		if err != nil {
+			atomic.AddUint64(&gt.dropped, uint64(len(pending)-i))
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (gt *gelfTarget) send(msg []byte) error {
+	if gt.conn.stream() {
+		frame := append(append([]byte(nil), msg...), 0)
+		if err := gt.conn.write(frame); err != nil {
+			return err
+		}
+		atomic.AddUint64(&gt.bytesWritten, uint64(len(frame)))
+		return nil
+	}
+	if gt.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(msg)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		msg = buf.Bytes()
+	}
+	datagrams, err := gelfChunks(msg, gt.chunkSize)
+	if err != nil {
+		return err
+	}
+	for _, d := range datagrams {
+		if err := gt.conn.write(d); err != nil {
+			return err
+		}
+		atomic.AddUint64(&gt.bytesWritten, uint64(len(d)))
+	}
+	return nil
+}
+
+//gelfChunks 不超过chunkSize时直接发送 否则分块 每块使用相同的随机消息ID
+func gelfChunks(msg []byte, chunkSize int) ([][]byte, error) {
+	if len(msg) <= chunkSize {
+		return [][]byte{msg}, nil
+	}
+	payload := chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + payload - 1) / payload
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("%w: %d bytes", errGELFTooLarge, len(msg))
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*payload)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*payload:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+//Probe 没有连接时尝试连接
+func (gt *gelfTarget) Probe() error {
+	return gt.conn.dial()
+}
+
+func (gt *gelfTarget) Close() error {
+	return gt.conn.shutdown()
+}
+
+func (gt *gelfTarget) TargetStats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&gt.bytesWritten),
+		Dropped:      atomic.LoadUint64(&gt.dropped),
+	}
+}
+
+func createGELFTarget(config map[string]interface{}) Target {
+	gt := &gelfTarget{
+		targetFilter: newTargetFilter(config),
+		compress:     configBool(config, "Compress", false),
+		chunkSize:    configInt(config, "ChunkSize", 8192),
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 1024*8),
+		locker:       &sync.Mutex{},
+	}
+	if gt.chunkSize <= gelfChunkHeaderSize {
+		log.Println("createGELFTarget: ChunkSize too small")
+		return nil
+	}
+	conn, err := newNetConn(config, "udp", "127.0.0.1:12201")
+	if err != nil {
+		log.Println("createGELFTarget:", err)
+		return nil
+	}
+	gt.conn = conn
+	gt.nextWriteTime = time.Now().Add(gt.interval)
+	return gt
+}
@@ -0,0 +1,149 @@
+package glog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGELFChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		chunks int
+		err    error
+	}{
+		{"single datagram", 100, 1, nil},
+		{"two chunks", 101, 2, nil},
+		{"max chunks", 128 * 88, 128, nil},
+		{"too large", 128*88 + 1, 0, errGELFTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := bytes.Repeat([]byte("x"), tt.size)
+			chunks, err := gelfChunks(msg, 100)
+			if !errors.Is(err, tt.err) || len(chunks) != tt.chunks {
+				t.Fatalf("got %d chunks, err %v", len(chunks), err)
+			}
+			if tt.chunks == 1 && !bytes.Equal(chunks[0], msg) {
+				t.Fatal("single datagram should not have a chunk header")
+			}
+			if tt.chunks > 1 {
+				if got := reassembleGELF(t, chunks, 100); !bytes.Equal(got, msg) {
+					t.Fatalf("reassembled %d bytes", len(got))
+				}
+			}
+		})
+	}
+}
+
+//reassembleGELF 检查分块头并按序号拼接
+func reassembleGELF(t *testing.T, chunks [][]byte, chunkSize int) []byte {
+	t.Helper()
+	parts := make([][]byte, len(chunks))
+	for _, c := range chunks {
+		if len(c) > chunkSize || !bytes.HasPrefix(c, gelfChunkMagic) {
+			t.Fatalf("bad chunk %x", c[:gelfChunkHeaderSize])
+		}
+		if !bytes.Equal(c[2:10], chunks[0][2:10]) || int(c[11]) != len(chunks) {
+			t.Fatalf("bad chunk header %x", c[:gelfChunkHeaderSize])
+		}
+		parts[c[10]] = c[gelfChunkHeaderSize:]
+	}
+	return bytes.Join(parts, nil)
+}
+
+func decodeGELF(t *testing.T, msg []byte) map[string]interface{} {
+	t.Helper()
+	if zr, err := gzip.NewReader(bytes.NewReader(msg)); err == nil {
+		if msg, err = io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		t.Fatalf("%v: %q", err, msg)
+	}
+	return fields
+}
+
+//randomText 压缩后大小基本不变的文本
+func randomText(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestGELFTargetUDP(t *testing.T) {
+	pc, ch := listenPacket(t, "udp", "127.0.0.1:0")
+	target := createGELFTarget(map[string]interface{}{
+		"Address":   pc.LocalAddr().String(),
+		"Compress":  true,
+		"ChunkSize": 200,
+	}).(*gelfTarget)
+	defer target.Close()
+	sr := &GELFSerializer{Host: "myhost"}
+	large := randomText(1000)
+	for _, msg := range []string{"small", randomText(30000), large} {
+		target.TryWrite(testEvent(WarnLevel, "app", msg), sr)
+	}
+	//太大的消息丢弃并返回错误 后面的消息继续发送
+	if err := target.Sync(); !errors.Is(err, errGELFTooLarge) {
+		t.Fatalf("Sync = %v, want errGELFTooLarge", err)
+	}
+	if stats := target.TargetStats(); stats.Dropped != 1 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+
+	fields := decodeGELF(t, receive(t, ch))
+	if fields["short_message"] != "small" || fields["host"] != "myhost" || fields["_logger"] != "app" || fields["level"] != 4.0 {
+		t.Fatalf("got %v", fields)
+	}
+	var chunks [][]byte
+	for {
+		chunk := receive(t, ch)
+		chunks = append(chunks, chunk)
+		if int(chunk[11]) == len(chunks) {
+			break
+		}
+	}
+	if len(chunks) < 2 {
+		t.Fatal("large message should be chunked")
+	}
+	if fields := decodeGELF(t, reassembleGELF(t, chunks, 200)); fields["short_message"] != large {
+		t.Fatalf("got %.40v", fields["short_message"])
+	}
+}
+
+func TestGELFTargetTCP(t *testing.T) {
+	ln, ch := listenStream(t)
+	target := createGELFTarget(map[string]interface{}{
+		"Network":  "tcp",
+		"Address":  ln.Addr().String(),
+		"Compress": true,
+	}).(*gelfTarget)
+	sr := &GELFSerializer{Host: "myhost"}
+	target.TryWrite(testEvent(InfoLevel, "app", "first"), sr)
+	target.TryWrite(testEvent(InfoLevel, "app", "second\nline"), sr)
+	if err := target.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	target.Close()
+
+	//tcp时以\0分帧 不压缩
+	frames := strings.Split(string(receive(t, ch)), "\x00")
+	if len(frames) != 3 || frames[2] != "" {
+		t.Fatalf("got %q", frames)
+	}
+	for i, want := range []string{"first", "second\nline"} {
+		if fields := decodeGELF(t, []byte(frames[i])); fields["short_message"] != want {
+			t.Fatalf("frame %d = %v", i, fields)
+		}
+	}
+}
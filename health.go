@@ -0,0 +1,63 @@
+package glog
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+//ErrorHandler 写入失败等错误的回调 targetName为Layout.ID 为空表示不是Target的错误(如配置文件监控)
+type ErrorHandler func(targetName string, err error)
+
+//defaultErrorHandler 没有设置ErrorHandler时输出到标准log
+func defaultErrorHandler(targetName string, err error) {
+	log.Println("glog:", targetName, ":", err)
+}
+
+//maxQueuedErrors 等待调用ErrorHandler的错误最多保留的数量 超过后丢弃
+const maxQueuedErrors = 1000
+
+//reportedError 等待调用ErrorHandler的错误
+type reportedError struct {
+	id  string
+	err error
+}
+
+//TargetStatus Target的错误统计 用于健康检查
+type TargetStatus struct {
+	ID            string //Layout.ID
+	Name          string //Target.Name()
+	ErrorCount    int64
+	LastError     error //最近一次错误 没有错误时为nil
+	LastErrorTime time.Time
+}
+
+//layoutState 记录每个Layout的错误以及写入数量 重新加载时按ID沿用
+type layoutState struct {
+	written uint64 //atomic 写入成功的事件数
+
+	locker        sync.Mutex
+	errorCount    int64     //protected by locker
+	lastError     error     //protected by locker
+	lastErrorTime time.Time //protected by locker
+}
+
+func (h *layoutState) record(err error) {
+	h.locker.Lock()
+	h.errorCount++
+	h.lastError = err
+	h.lastErrorTime = time.Now()
+	h.locker.Unlock()
+}
+
+func (h *layoutState) status(layout *Layout) TargetStatus {
+	h.locker.Lock()
+	defer h.locker.Unlock()
+	return TargetStatus{
+		ID:            layout.ID,
+		Name:          layout.Target.Name(),
+		ErrorCount:    h.errorCount,
+		LastError:     h.lastError,
+		LastErrorTime: h.lastErrorTime,
+	}
+}
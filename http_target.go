@@ -0,0 +1,284 @@
+package glog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//httpSender 发送http请求 5xx和429以及网络错误时按指数退避重试
+//失败的batch保留到之后的Sync重试 等待期间不阻塞调用者 不是线程安全的
+type httpSender struct {
+	client   *http.Client
+	url      string
+	method   string
+	headers  map[string]string
+	gzip     bool
+	retries  int           //失败后的重试次数
+	retryMin time.Duration //第1次重试前的等待时间 之后每次翻倍
+	retryMax time.Duration //最大等待时间 Retry-After超过时也按retryMax
+
+	batch     *httpBatch //等待重试的batch
+	attempts  int        //batch已经发送的次数
+	nextRetry time.Time  //在此之前不会重试
+	lastErr   error      //batch最近1次失败的错误
+
+	dropped      uint64 //atomic
+	bytesWritten uint64 //atomic
+}
+
+//httpBatch 1次请求的内容
+type httpBatch struct {
+	body        []byte //已经压缩
+	contentType string
+	size        int //压缩前的字节数
+	count       int //日志条数
+}
+
+func newHTTPSender(config map[string]interface{}) (*httpSender, error) {
+	hs := &httpSender{
+		client:   &http.Client{Timeout: configDuration(config, "Timeout", 10*time.Second)},
+		url:      configString(config, "URL", ""),
+		method:   configString(config, "Method", http.MethodPost),
+		headers:  make(map[string]string),
+		gzip:     configBool(config, "Gzip", false),
+		retries:  configInt(config, "Retries", 3),
+		retryMin: configDuration(config, "RetryMin", 500*time.Millisecond),
+		retryMax: configDuration(config, "RetryMax", 10*time.Second),
+	}
+	if hs.url == "" {
+		return nil, fmt.Errorf("empty URL")
+	}
+	for k, v := range configMap(config, "Headers") {
+		if s, ok := v.(string); ok {
+			hs.headers[k] = s
+		}
+	}
+	return hs, nil
+}
+
+//sync 先重试保留的batch 成功后调用build生成新的batch发送
+//build返回count为0表示没有日志 等待重试期间不调用build 返回最近1次失败的错误
+func (hs *httpSender) sync(build func() (body []byte, contentType string, count int)) error {
+	for {
+		retried := hs.batch != nil
+		if retried && time.Now().Before(hs.nextRetry) {
+			return fmt.Errorf("waiting to retry: %w", hs.lastErr)
+		}
+		if !retried {
+			body, contentType, count := build()
+			if count == 0 {
+				return nil
+			}
+			batch, err := hs.newBatch(body, contentType, count)
+			if err != nil {
+				atomic.AddUint64(&hs.dropped, uint64(count))
+				return err
+			}
+			hs.batch = batch
+		}
+		if err := hs.send(); err != nil {
+			return err
+		}
+		if !retried {
+			return nil
+		}
+	}
+}
+
+func (hs *httpSender) newBatch(body []byte, contentType string, count int) (*httpBatch, error) {
+	batch := &httpBatch{body: body, contentType: contentType, size: len(body), count: count}
+	if hs.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		batch.body = buf.Bytes()
+	}
+	return batch, nil
+}
+
+//send 发送1次batch 失败时计算下次重试的时间 超过重试次数或者不能重试时丢弃
+func (hs *httpSender) send() error {
+	batch := hs.batch
+	retry, wait, err := hs.do(batch.body, batch.contentType)
+	if err == nil {
+		atomic.AddUint64(&hs.bytesWritten, uint64(batch.size))
+		hs.reset()
+		return nil
+	}
+	hs.attempts++
+	if !retry || hs.attempts > hs.retries {
+		atomic.AddUint64(&hs.dropped, uint64(batch.count))
+		hs.reset()
+		return err
+	}
+	delay := hs.retryMin << uint(hs.attempts-1)
+	if wait > delay {
+		delay = wait
+	}
+	if delay > hs.retryMax || delay <= 0 {
+		delay = hs.retryMax
+	}
+	hs.nextRetry = time.Now().Add(delay)
+	hs.lastErr = err
+	return err
+}
+
+func (hs *httpSender) reset() {
+	hs.batch = nil
+	hs.attempts = 0
+	hs.lastErr = nil
+}
+
+func (hs *httpSender) stats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&hs.bytesWritten),
+		Dropped:      atomic.LoadUint64(&hs.dropped),
+	}
+}
+
+//do 发送1次请求 retry表示是否可以重试 wait为服务器通过Retry-After要求的等待时间
+func (hs *httpSender) do(body []byte, contentType string) (retry bool, wait time.Duration, err error) {
+	req, err := http.NewRequest(hs.method, hs.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if hs.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range hs.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, 0, nil
+	}
+	err = fmt.Errorf("%s %s: %s %s", hs.method, hs.url, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		if seconds, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return true, wait, err
+	}
+	return false, 0, err
+}
+
+//httpTarget 批量POST日志 格式为NDJSON或者JSON数组(需要使用json序列化)
+type httpTarget struct {
+	targetFilter
+	sender    *httpSender
+	array     bool          //以JSON数组发送 否则为NDJSON
+	interval  time.Duration //只读 写入的时间间隔
+	cacheSize int           //缓存超过该大小时写入
+
+	locker      *sync.Mutex
+	pending     [][]byte //protected by locker
+	pendingSize int      //protected by locker
+
+	nextWriteTime time.Time
+}
+
+func (ht *httpTarget) Write(event *LogEvent, sr Serializer) {
+	ht.TryWrite(event, sr)
+}
+
+func (ht *httpTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		return fmt.Errorf("encode event failed")
+	}
+	ht.locker.Lock()
+	ht.pending = append(ht.pending, bs)
+	ht.pendingSize += len(bs) + 1
+	ht.locker.Unlock()
+	return nil
+}
+
+func (ht *httpTarget) Overflow() bool {
+	ht.locker.Lock()
+	size := ht.pendingSize
+	ht.locker.Unlock()
+	return time.Now().After(ht.nextWriteTime) || size >= ht.cacheSize
+}
+
+func (ht *httpTarget) Flush() {
+	ht.Sync()
+}
+
+//Sync 把缓存的日志作为1个请求发送 失败的请求保留到之后的Sync重试 超过重试次数后丢弃
+func (ht *httpTarget) Sync() error {
+	defer func() {
+		ht.nextWriteTime = time.Now().Add(ht.interval)
+	}()
+	return ht.sender.sync(ht.build)
+}
+
+//build 取出缓存的日志生成请求的内容
+func (ht *httpTarget) build() ([]byte, string, int) {
+	ht.locker.Lock()
+	pending := ht.pending
+	ht.pending = nil
+	ht.pendingSize = 0
+	ht.locker.Unlock()
+	if len(pending) == 0 {
+		return nil, "", 0
+	}
+	if ht.array {
+		body := append([]byte{'['}, bytes.Join(pending, []byte{','})...)
+		return append(body, ']'), "application/json", len(pending)
+	}
+	return append(bytes.Join(pending, []byte{'\n'}), '\n'), "application/x-ndjson", len(pending)
+}
+
+//Discard 丢弃缓存以及等待重试的日志 由调用者重新写入
+func (ht *httpTarget) Discard() {
+	ht.locker.Lock()
+	ht.pending = nil
+	ht.pendingSize = 0
+	ht.locker.Unlock()
+	ht.sender.reset()
+}
+
+//Close 关闭空闲的keep-alive连接
+func (ht *httpTarget) Close() error {
+	ht.sender.client.CloseIdleConnections()
+	return nil
+}
+
+func (ht *httpTarget) TargetStats() TargetStats {
+	return ht.sender.stats()
+}
+
+func createHTTPTarget(config map[string]interface{}) Target {
+	sender, err := newHTTPSender(config)
+	if err != nil {
+		log.Println("createHTTPTarget:", err)
+		return nil
+	}
+	ht := &httpTarget{
+		targetFilter: newTargetFilter(config),
+		sender:       sender,
+		array:        configString(config, "Format", "ndjson") == "array",
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 1024*64),
+		locker:       &sync.Mutex{},
+	}
+	ht.nextWriteTime = time.Now().Add(ht.interval)
+	return ht
+}
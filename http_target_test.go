@@ -0,0 +1,187 @@
+package glog
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+//request 测试服务器收到的请求
+type request struct {
+	contentType string
+	encoding    string
+	body        string
+}
+
+//collector 按顺序返回statuses中的状态码 之后返回200
+type collector struct {
+	locker     sync.Mutex
+	statuses   []int
+	retryAfter string
+	requests   []request
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = zr
+	}
+	body, _ := io.ReadAll(reader)
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.requests = append(c.requests, request{
+		contentType: r.Header.Get("Content-Type"),
+		encoding:    r.Header.Get("Content-Encoding"),
+		body:        string(body),
+	})
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		if c.retryAfter != "" {
+			w.Header().Set("Retry-After", c.retryAfter)
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func (c *collector) received() []request {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return append([]request(nil), c.requests...)
+}
+
+func newCollector(t *testing.T, c *collector) string {
+	t.Helper()
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestHTTPTargetFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		gzip        bool
+		contentType string
+		body        string
+	}{
+		{"ndjson", "ndjson", false, "application/x-ndjson", "first\nsecond\n"},
+		{"array", "array", false, "application/json", "[first,second]"},
+		{"gzip", "ndjson", true, "application/x-ndjson", "first\nsecond\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{}
+			target := createHTTPTarget(map[string]interface{}{
+				"URL":    newCollector(t, c),
+				"Format": tt.format,
+				"Gzip":   tt.gzip,
+			}).(*httpTarget)
+			defer target.Close()
+			target.TryWrite(testEvent(InfoLevel, "app", "first"), messageSerializer{})
+			target.TryWrite(testEvent(InfoLevel, "app", "second"), messageSerializer{})
+			if err := target.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			requests := c.received()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests", len(requests))
+			}
+			r := requests[0]
+			if r.contentType != tt.contentType || r.body != tt.body || (r.encoding == "gzip") != tt.gzip {
+				t.Fatalf("got %+v", r)
+			}
+			if stats := target.TargetStats(); stats.BytesWritten != uint64(len(tt.body)) {
+				t.Fatalf("BytesWritten = %d", stats.BytesWritten)
+			}
+		})
+	}
+}
+
+func TestHTTPTargetRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		retries    int
+		bodies     []string
+		dropped    uint64
+	}{
+		{
+			name:     "retry on a later sync",
+			statuses: []int{503},
+			retries:  3,
+			bodies:   []string{"first\n", "first\n", "second\n"},
+		},
+		{
+			name:       "retry-after capped at RetryMax",
+			statuses:   []int{429},
+			retryAfter: "3600",
+			retries:    3,
+			bodies:     []string{"first\n", "first\n", "second\n"},
+		},
+		{
+			name:     "dropped after retries",
+			statuses: []int{500, 500},
+			retries:  1,
+			bodies:   []string{"first\n", "first\n", "second\n"},
+			dropped:  1,
+		},
+		{
+			name:     "not retryable",
+			statuses: []int{400},
+			retries:  3,
+			bodies:   []string{"first\n", "second\n"},
+			dropped:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &collector{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			target := createHTTPTarget(map[string]interface{}{
+				"URL":      newCollector(t, c),
+				"Retries":  tt.retries,
+				"RetryMin": "10ms",
+				"RetryMax": "50ms",
+			}).(*httpTarget)
+			defer target.Close()
+			target.TryWrite(testEvent(InfoLevel, "app", "first"), messageSerializer{})
+			start := time.Now()
+			if err := target.Sync(); err == nil {
+				t.Fatal("Sync should return the first failure")
+			}
+			//等待重试期间不阻塞 也不发送新的日志
+			target.TryWrite(testEvent(InfoLevel, "app", "second"), messageSerializer{})
+			target.Sync()
+			if d := time.Since(start); d > time.Second {
+				t.Fatalf("Sync blocked %v", d)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for len(c.received()) < len(tt.bodies) && time.Now().Before(deadline) {
+				time.Sleep(20 * time.Millisecond)
+				target.Sync()
+			}
+			requests := c.received()
+			if len(requests) != len(tt.bodies) {
+				t.Fatalf("got %d requests: %+v", len(requests), requests)
+			}
+			for i, r := range requests {
+				if r.body != tt.bodies[i] {
+					t.Fatalf("request %d = %q, want %q", i, r.body, tt.bodies[i])
+				}
+			}
+			if stats := target.TargetStats(); stats.Dropped != tt.dropped {
+				t.Fatalf("Dropped = %d, want %d", stats.Dropped, tt.dropped)
+			}
+		})
+	}
+}
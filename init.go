@@ -2,6 +2,7 @@ package glog
 
 import (
 	"log"
+	"os"
 
 	"github.com/dalixu/glogger"
 )
@@ -29,10 +30,21 @@ func init() {
 	globalSerializer = make(map[string]Serializer)
 	globalSerializer["plain"] = &DefaultSerializer{}
 	globalSerializer["json"] = &JSONSerializer{}
+	globalSerializer["otel-json"] = &JSONSerializer{Style: "otel"}
+	globalSerializer["gelf"] = &GELFSerializer{}
 
 	globalTarget = make(map[string]TargetCtor)
 	globalTarget["file"] = createFileTarget
 	globalTarget["console"] = createConsoleTarget
+	globalTarget["syslog"] = createSyslogTarget
+	globalTarget["net"] = createNetTarget
+	globalTarget["http"] = createHTTPTarget
+	globalTarget["journald"] = createJournaldTarget
+	globalTarget["memory"] = createMemoryTarget
+	globalTarget["failover"] = createFailoverTarget
+	globalTarget["spool"] = createSpoolTarget
+	globalTarget["otlp"] = createOTLPTarget
+	globalTarget["gelf"] = createGELFTarget
 }
 
 var globalSerializer map[string]Serializer
@@ -68,6 +80,17 @@ func findTarget(name string, config map[string]interface{}) Target {
 	return target(config)
 }
 
+//exitFunc Fatal时调用 测试时可以通过SetExitFunc替换
+var exitFunc = os.Exit
+
+//SetExitFunc 替换Fatal时调用的退出函数 fn为nil时恢复为os.Exit
+func SetExitFunc(fn func(code int)) {
+	if fn == nil {
+		fn = os.Exit
+	}
+	exitFunc = fn
+}
+
 //New 返回1个Manager对象 通常1个程序1个manager就可以了
 func New(path string) Manager {
 	file := newConfigFile()
@@ -78,3 +101,8 @@ func New(path string) Manager {
 	}
 	return newManager(config, file)
 }
+
+//NewWithConfig 使用代码创建的配置返回1个Manager 不监控配置文件
+func NewWithConfig(config *LogConfig) Manager {
+	return newManager(config, newConfigFile())
+}
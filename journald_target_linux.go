@@ -0,0 +1,208 @@
+package glog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+//journaldTarget 使用native协议写入systemd-journald
+//消息过大时写入memfd 通过SCM_RIGHTS发送文件描述符
+type journaldTarget struct {
+	targetFilter
+	socket     *net.UnixAddr
+	identifier string //SYSLOG_IDENTIFIER
+
+	conn         *net.UnixConn
+	dropped      uint64 //atomic
+	bytesWritten uint64 //atomic
+}
+
+//Write 发送失败时计入dropped TryWrite返回的错误由调用者统计
+func (jt *journaldTarget) Write(event *LogEvent, sr Serializer) {
+	if err := jt.TryWrite(event, sr); err != nil {
+		atomic.AddUint64(&jt.dropped, 1)
+	}
+}
+
+//TryWrite 直接发送 不缓存
+func (jt *journaldTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	data := jt.encode(event, bs)
+	_, _, err := jt.conn.WriteMsgUnix(data, nil, jt.socket)
+	if err != nil && (errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)) {
+		err = jt.sendFile(data)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&jt.bytesWritten, uint64(len(data)))
+	return nil
+}
+
+func (jt *journaldTarget) encode(event *LogEvent, msg []byte) []byte {
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", msg)
+	journalField(&buf, "PRIORITY", []byte(strconv.Itoa(syslogSeverity(event.Level))))
+	journalField(&buf, "SYSLOG_IDENTIFIER", []byte(jt.identifier))
+	journalField(&buf, "GLOG_LOGGER", []byte(event.Name))
+	if event.Caller != nil {
+		journalField(&buf, "CODE_FILE", []byte(event.Caller.File))
+		journalField(&buf, "CODE_LINE", []byte(strconv.Itoa(event.Caller.Line)))
+		journalField(&buf, "CODE_FUNC", []byte(event.Caller.Function))
+	}
+	if event.Err != nil {
+		journalField(&buf, "ERROR", []byte(event.Err.Error()))
+	}
+	for k, v := range event.Properties {
+		name := journalFieldName(k)
+		if name == "" {
+			continue
+		}
+		journalField(&buf, name, []byte(fmt.Sprint(v)))
+	}
+	return buf.Bytes()
+}
+
+//journalField 值中包含换行时使用二进制格式 NAME\n 8字节小端长度 值\n
+func journalField(buf *bytes.Buffer, name string, value []byte) {
+	buf.WriteString(name)
+	if bytes.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.Write(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
+
+//journalFieldName 转为大写 只保留字母数字和下划线 不能以下划线或数字开头
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(key) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+//sendFile 写入memfd并密封 然后发送文件描述符 memfd不可用时使用/dev/shm中的临时文件
+func (jt *journaldTarget) sendFile(data []byte) error {
+	f, err := memfdCreate("glog-journal")
+	sealed := err == nil
+	if err != nil {
+		f, err = os.CreateTemp("/dev/shm", "glog-journal-")
+		if err != nil {
+			return err
+		}
+		os.Remove(f.Name())
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if sealed {
+		//F_ADD_SEALS F_SEAL_SEAL|F_SEAL_SHRINK|F_SEAL_GROW|F_SEAL_WRITE
+		syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), 1033, 1|2|4|8)
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	_, _, err = jt.conn.WriteMsgUnix(nil, rights, jt.socket)
+	return err
+}
+
+//memfdCreateTrap memfd_create的系统调用号 syscall包中没有定义
+var memfdCreateTrap = map[string]uintptr{
+	"amd64":   319,
+	"386":     356,
+	"arm":     385,
+	"arm64":   279,
+	"riscv64": 279,
+	"loong64": 279,
+	"ppc64":   360,
+	"ppc64le": 360,
+	"s390x":   350,
+}
+
+func memfdCreate(name string) (*os.File, error) {
+	trap, ok := memfdCreateTrap[runtime.GOARCH]
+	if !ok {
+		return nil, syscall.ENOSYS
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	//MFD_CLOEXEC|MFD_ALLOW_SEALING
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(p)), 1|2, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, name), nil
+}
+
+func (jt *journaldTarget) Overflow() bool {
+	return false
+}
+
+func (jt *journaldTarget) Flush() {
+}
+
+func (jt *journaldTarget) Sync() error {
+	return nil
+}
+
+func (jt *journaldTarget) Close() error {
+	return jt.conn.Close()
+}
+
+func (jt *journaldTarget) TargetStats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&jt.bytesWritten),
+		Dropped:      atomic.LoadUint64(&jt.dropped),
+	}
+}
+
+func createJournaldTarget(config map[string]interface{}) Target {
+	jt := &journaldTarget{
+		targetFilter: newTargetFilter(config),
+		socket: &net.UnixAddr{
+			Name: configString(config, "Socket", "/run/systemd/journal/socket"),
+			Net:  "unixgram",
+		},
+		identifier: configString(config, "Identifier", path.Base(os.Args[0])),
+	}
+	//不绑定地址 由内核自动分配
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "", Net: "unixgram"})
+	if err != nil {
+		log.Println("createJournaldTarget:", err)
+		return nil
+	}
+	jt.conn = conn
+	return jt
+}
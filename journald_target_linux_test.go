@@ -0,0 +1,205 @@
+package glog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//fakeJournal 模拟journald的socket 文件描述符发送的消息读取文件内容
+func fakeJournal(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ch := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 1<<20)
+		oob := make([]byte, syscall.CmsgSpace(4))
+		for {
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			if err != nil {
+				close(ch)
+				return
+			}
+			if oobn == 0 {
+				ch <- append([]byte(nil), buf[:n]...)
+				continue
+			}
+			data, err := readRights(oob[:oobn])
+			if err != nil {
+				t.Error(err)
+			}
+			ch <- data
+		}
+	}()
+	return socket, ch
+}
+
+func readRights(oob []byte) ([]byte, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil || len(msgs) != 1 {
+		return nil, errors.New("bad control message")
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return nil, errors.New("bad unix rights")
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+//parseJournal 解析native协议 NAME=value\n 或者 NAME\n 8字节小端长度 value\n
+func parseJournal(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatalf("bad field %q", data)
+		}
+		name := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				t.Fatalf("field %s not terminated", name)
+			}
+			fields[name] = string(data[i+1 : i+end])
+			data = data[i+end+1:]
+			continue
+		}
+		data = data[i+1:]
+		if len(data) < 8 {
+			t.Fatalf("short size for %s", name)
+		}
+		size := binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		if uint64(len(data)) < size+1 || data[size] != '\n' {
+			t.Fatalf("bad binary field %s", name)
+		}
+		fields[name] = string(data[:size])
+		data = data[size+1:]
+	}
+	return fields
+}
+
+func TestJournaldTarget(t *testing.T) {
+	large := strings.Repeat("x", 1<<19)
+	tests := []struct {
+		name   string
+		event  func() *LogEvent
+		fields map[string]string
+	}{
+		{
+			name:  "text fields",
+			event: func() *LogEvent { return testEvent(WarnLevel, "db", "slow query") },
+			fields: map[string]string{
+				"MESSAGE":           "slow query",
+				"PRIORITY":          "4",
+				"SYSLOG_IDENTIFIER": "myapp",
+				"GLOG_LOGGER":       "db",
+			},
+		},
+		{
+			name: "binary fields",
+			event: func() *LogEvent {
+				e := testEvent(ErrorLevel, "db", "failed\nsecond line")
+				e.Err = errors.New("line1\nline2")
+				e.Properties = Properties{"request-id": "abc", "2query": "select\n1"}
+				return e
+			},
+			fields: map[string]string{
+				"MESSAGE":    "failed\nsecond line",
+				"PRIORITY":   "3",
+				"ERROR":      "line1\nline2",
+				"REQUEST_ID": "abc",
+				"QUERY":      "select\n1",
+			},
+		},
+		{
+			name:  "memfd for large messages",
+			event: func() *LogEvent { return testEvent(InfoLevel, "app", large) },
+			fields: map[string]string{
+				"MESSAGE":  large,
+				"PRIORITY": "6",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket, ch := fakeJournal(t)
+			target := createJournaldTarget(map[string]interface{}{
+				"Socket":     socket,
+				"Identifier": "myapp",
+			}).(*journaldTarget)
+			defer target.Close()
+			if err := target.TryWrite(tt.event(), messageSerializer{}); err != nil {
+				t.Fatal(err)
+			}
+			var data []byte
+			select {
+			case data = <-ch:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout")
+			}
+			fields := parseJournal(t, data)
+			for name, want := range tt.fields {
+				if got := fields[name]; got != want {
+					t.Fatalf("%s = %.40q, want %.40q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJournaldTargetNoSocket(t *testing.T) {
+	target := createJournaldTarget(map[string]interface{}{
+		"Socket": filepath.Join(t.TempDir(), "missing.sock"),
+	}).(*journaldTarget)
+	defer target.Close()
+	if err := target.TryWrite(testEvent(InfoLevel, "app", "hello"), messageSerializer{}); err == nil {
+		t.Fatal("TryWrite should fail without journald")
+	}
+	//TryWrite返回错误时由Manager统计
+	if stats := target.TargetStats(); stats.Dropped != 0 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+	target.Write(testEvent(InfoLevel, "app", "hello"), messageSerializer{})
+	if stats := target.TargetStats(); stats.Dropped != 1 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+}
+
+func TestJournaldTargetManagerDropped(t *testing.T) {
+	config := NewLogConfig()
+	config.Layouts = []*Layout{{
+		Target: createJournaldTarget(map[string]interface{}{
+			"Socket": filepath.Join(t.TempDir(), "missing.sock"),
+		}),
+		Serializer: messageSerializer{},
+	}}
+	m := NewWithConfig(config)
+	defer m.Close(context.Background())
+	m.SetErrorHandler(func(string, error) {})
+	m.GetLogger("app").Info("hello")
+	m.Flush(context.Background())
+	if stats := m.Stats(); stats.Dropped != 1 {
+		t.Fatalf("Dropped = %d, want 1", stats.Dropped)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package glog
+
+import (
+	"log"
+)
+
+//createJournaldTarget journald只在linux上可用
+func createJournaldTarget(config map[string]interface{}) Target {
+	log.Println("createJournaldTarget: journald is only supported on linux")
+	return nil
+}
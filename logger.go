@@ -2,9 +2,8 @@
 package glog
 
 import (
+	"context"
 	"fmt"
-	"runtime"
-	"runtime/debug"
 	"time"
 
 	"github.com/dalixu/glogger"
@@ -26,14 +25,34 @@ type LogEvent struct {
 	Name       string
 	Format     string //format或者message
 	Args       []interface{}
-	StackTrace string
+	Err        error   //附带的error 序列化为error对象
+	Caller     *Caller //调用者 无法获取时为nil
+	StackTrace string  //完整堆栈 由配置的StackMode决定是否捕获
 	Time       string
+	Timestamp  time.Time       //Time对应的时间
+	Context    context.Context //通过Logger.WithContext指定 用于读取trace等 可能为nil
+}
+
+//Message 格式化后的消息 Format为空时为fmt.Sprint(Args...) Serializer和自定义Target都应该使用它
+func (e *LogEvent) Message() string {
+	if e.Format != "" {
+		return fmt.Sprintf(e.Format, e.Args...)
+	}
+	return fmt.Sprint(e.Args...)
 }
 
 //Logger 日志打印接口 方便替换为第三方log
 type Logger interface {
 	glogger.GLogger
 	WriteEvent(e LogEvent) //也许应该用*LogEvent
+	//WithCallerSkip 返回1个额外跳过skip层调用的Logger 用于封装glog的库
+	WithCallerSkip(skip int) Logger
+	//Err 返回1个附带err的Logger 之后写入的LogEvent.Err为err
+	Err(err error) Logger
+	//WithContext 返回1个附带ctx的Logger 之后写入的LogEvent.Context为ctx
+	WithContext(ctx context.Context) Logger
+	Panic(v ...interface{})
+	Panicf(format string, v ...interface{})
 }
 
 //newLogger 返回Flogger
@@ -47,12 +66,35 @@ func newLogger(mr Manager, name string) Logger {
 type logger struct {
 	Manager
 	name string
+	skip int             //额外跳过的调用层数
+	err  error           //附带的error
+	ctx  context.Context //附带的context
 }
 
 func (lr *logger) WriteEvent(e LogEvent) {
 	lr.Manager.WriteEvent(e)
 }
 
+func (lr *logger) WithCallerSkip(skip int) Logger {
+	l := *lr
+	l.skip += skip
+	return &l
+}
+
+func (lr *logger) Err(err error) Logger {
+	l := *lr
+	if !isNilError(err) {
+		l.err = err
+	}
+	return &l
+}
+
+func (lr *logger) WithContext(ctx context.Context) Logger {
+	l := *lr
+	l.ctx = ctx
+	return &l
+}
+
 //Trace 实现接口
 func (lr *logger) Trace(v ...interface{}) {
 	lr.write(TraceLevel, "TRACE", v...)
@@ -103,6 +145,16 @@ func (lr *logger) Errorf(format string, v ...interface{}) {
 	lr.writef(ErrorLevel, "ERROR", format, v...)
 }
 
+//Panic 写入后flush 然后panic
+func (lr *logger) Panic(v ...interface{}) {
+	lr.write(PanicLevel, "PANIC", v...)
+}
+
+//Panicf 写入后flush 然后panic
+func (lr *logger) Panicf(format string, v ...interface{}) {
+	lr.writef(PanicLevel, "PANIC", format, v...)
+}
+
 //Critical 实现接口
 func (lr *logger) Fatal(v ...interface{}) {
 	lr.write(FatalLevel, "FATAL", v...)
@@ -114,43 +166,58 @@ func (lr *logger) Fatalf(format string, v ...interface{}) {
 }
 
 func (lr *logger) write(level LogLevel, desc string, args ...interface{}) {
-	stackTrace := ""
-	if level >= ErrorLevel {
-		stackTrace = string(debug.Stack())
-	} else {
-		_, file, line, ok := runtime.Caller(2)
-		if ok {
-			stackTrace = fmt.Sprintf("%s:%d", file, line)
-		}
-	}
-	lr.WriteEvent(LogEvent{
-		Level:      level,
-		LevelDesc:  desc,
-		Name:       lr.name,
-		Args:       args,
-		StackTrace: stackTrace,
-		Time:       time.Now().Format("2006-01-02 15:04:05.0000"),
-	})
+	lr.output(level, desc, "", args)
 }
 
 func (lr *logger) writef(level LogLevel, desc string, format string, args ...interface{}) {
+	lr.output(level, desc, format, args)
+}
+
+//output 调用层次固定为 用户代码->Trace等->write/writef->output
+func (lr *logger) output(level LogLevel, desc string, format string, args []interface{}) {
+	mode, stackLevel, trim, fatalExit := StackLevel, LogLevel(ErrorLevel), false, true
+	if h, ok := lr.Manager.(configHolder); ok {
+		config := h.currentConfig()
+		mode, stackLevel, trim, fatalExit = config.StackMode, config.StackLevel, config.TrimPath, config.FatalExit
+	}
+	//没有通过Err指定时 取参数中的第1个error
+	err := lr.err
+	if err == nil {
+		err = firstError(args)
+	}
+	skip := 3 + lr.skip
 	stackTrace := ""
-	if level >= ErrorLevel {
-		stackTrace = string(debug.Stack())
-	} else {
-		_, file, line, ok := runtime.Caller(2)
-		if ok {
-			stackTrace = fmt.Sprintf("%s:%d", file, line)
-		}
+	if (mode == StackLevel && level >= stackLevel) || (mode == StackError && err != nil) {
+		stackTrace = getStack(skip, trim)
 	}
+	now := time.Now()
 	lr.WriteEvent(LogEvent{
 		Level:      level,
 		LevelDesc:  desc,
 		Name:       lr.name,
 		Format:     format,
 		Args:       args,
+		Err:        err,
+		Caller:     getCaller(skip, trim),
 		StackTrace: stackTrace,
-		Time:       time.Now().Format("2006-01-02 15:04:05.0000"),
+		Time:       now.Format("2006-01-02 15:04:05.0000"),
+		Timestamp:  now,
+		Context:    lr.ctx,
 	})
+	if level == PanicLevel {
+		lr.sync()
+		if format != "" {
+			panic(fmt.Sprintf(format, args...))
+		}
+		panic(fmt.Sprint(args...))
+	}
+	if level == FatalLevel && fatalExit {
+		lr.sync()
+		exitFunc(1)
+	}
+}
 
+//sync 同步写入所有Target 用于Panic和Fatal
+func (lr *logger) sync() {
+	lr.Manager.Flush(context.Background())
 }
@@ -0,0 +1,117 @@
+package glog
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+//newBufferedManager 日志缓存在WriterTarget中 flush后才写入buf
+func newBufferedManager(t *testing.T, buf *bytes.Buffer, fatalExit bool) Manager {
+	t.Helper()
+	config := NewLogConfig()
+	config.Async = true
+	config.FatalExit = fatalExit
+	config.Layouts = []*Layout{{
+		Target:     NewWriterTarget(buf, WriterOptions{BufferSize: 1 << 20}),
+		Serializer: messageSerializer{},
+	}}
+	m := NewWithConfig(config)
+	t.Cleanup(func() { m.Close(context.Background()) })
+	return m
+}
+
+//captureExit 替换exitFunc 记录退出码以及退出时buf的内容
+func captureExit(t *testing.T, buf *bytes.Buffer) (codes *[]int, output *string) {
+	t.Helper()
+	codes, output = &[]int{}, new(string)
+	SetExitFunc(func(code int) {
+		*codes = append(*codes, code)
+		*output = buf.String()
+	})
+	t.Cleanup(func() { SetExitFunc(nil) })
+	return codes, output
+}
+
+func TestLoggerFatal(t *testing.T) {
+	var buf bytes.Buffer
+	m := newBufferedManager(t, &buf, true)
+	codes, output := captureExit(t, &buf)
+	m.GetLogger("app").Fatalf("cannot open %s", "db")
+	//退出前已经flush
+	if len(*codes) != 1 || (*codes)[0] != 1 || *output != "cannot open db\n" {
+		t.Fatalf("exit codes = %v output = %q", *codes, *output)
+	}
+}
+
+func TestLoggerFatalNoExit(t *testing.T) {
+	var buf bytes.Buffer
+	m := newBufferedManager(t, &buf, false)
+	codes, _ := captureExit(t, &buf)
+	m.GetLogger("app").Fatal("cannot open db")
+	if len(*codes) != 0 {
+		t.Fatalf("exit called with %v", *codes)
+	}
+	m.Flush(context.Background())
+	if buf.String() != "cannot open db\n" {
+		t.Fatalf("got %q", buf.String())
+	}
+}
+
+func TestLoggerPanicf(t *testing.T) {
+	var buf bytes.Buffer
+	m := newBufferedManager(t, &buf, true)
+	defer func() {
+		r := recover()
+		if r != "bad state 42" {
+			t.Fatalf("recover() = %v", r)
+		}
+		//panic前已经flush
+		if buf.String() != "bad state 42\n" {
+			t.Fatalf("got %q", buf.String())
+		}
+	}()
+	m.GetLogger("app").Panicf("bad state %d", 42)
+	t.Fatal("Panicf should panic")
+}
+
+func TestPanicFatalLevels(t *testing.T) {
+	if PanicLevel != 6 || FatalLevel != 7 {
+		t.Fatalf("PanicLevel = %d FatalLevel = %d", PanicLevel, FatalLevel)
+	}
+	for name, want := range map[string]LogLevel{"Error": ErrorLevel, "Panic": PanicLevel, "Fatal": FatalLevel} {
+		if got := toLevel(name); got != want {
+			t.Fatalf("toLevel(%s) = %d, want %d", name, got, want)
+		}
+		if got := parseLevelName(name); got != want {
+			t.Fatalf("parseLevelName(%s) = %d, want %d", name, got, want)
+		}
+	}
+	if levelName(PanicLevel) != "PANIC" || levelName(FatalLevel) != "FATAL" {
+		t.Fatalf("levelName = %s %s", levelName(PanicLevel), levelName(FatalLevel))
+	}
+
+	//配置文件中的MinLevel MaxLevel
+	tests := []struct {
+		min, max string
+		want     []LogLevel
+	}{
+		{"Fatal", "", []LogLevel{FatalLevel}},
+		{"Panic", "", []LogLevel{PanicLevel, FatalLevel}},
+		{"Error", "Panic", []LogLevel{ErrorLevel, PanicLevel}},
+		{"", "Error", []LogLevel{WarnLevel, ErrorLevel}},
+	}
+	for _, tt := range tests {
+		target := createConsoleTarget(map[string]interface{}{"MinLevel": tt.min, "MaxLevel": tt.max})
+		var got []LogLevel
+		for _, level := range []LogLevel{WarnLevel, ErrorLevel, PanicLevel, FatalLevel} {
+			if match(testEvent(level, "app", "msg"), target) {
+				got = append(got, level)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("MinLevel %q MaxLevel %q matched %v, want %v", tt.min, tt.max, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package glog
 
 import (
 	"container/list"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,7 +14,23 @@ import (
 type Manager interface {
 	GetLogger(name string) Logger
 	WriteEvent(event LogEvent)
-	Close()
+	//Flush 同步写入异步队列以及所有Target的缓存 返回Target写入失败的错误
+	Flush(ctx context.Context) error
+	//Close 停止配置监控和写入循环并flush 可以多次调用 ctx到期时返回ctx.Err() 关闭会在后台继续
+	Close(ctx context.Context) error
+	//SetErrorHandler 设置错误回调 为nil时输出到标准log
+	SetErrorHandler(handler ErrorHandler)
+	//TargetStatus 返回当前每个Layout的错误统计
+	TargetStatus() []TargetStatus
+	//Stats 返回统计快照
+	Stats() Stats
+	//Use 添加Middleware 按添加顺序在配置文件中的Middlewares之前执行
+	Use(mws ...Middleware)
+}
+
+//configHolder logger通过它读取当前配置
+type configHolder interface {
+	currentConfig() *LogConfig
 }
 
 //manager 日志写入
@@ -23,8 +41,24 @@ type manager struct {
 	rwLocker *sync.RWMutex
 	config   *LogConfig // protected by rwLocker
 
+	flushLocker *sync.Mutex //保证Overflow和Flush同一时刻只在1个routine中调用
+
 	queue        *list.List
 	atomicLocker int64
+
+	errorHandler atomic.Value //ErrorHandler
+	handler      atomic.Value //Handler 包括所有Middleware的处理链
+	middlewares  []Middleware //protected by mwLocker 通过Use添加的Middleware
+	mwLocker     sync.Mutex
+	metrics      metrics
+
+	errLocker   sync.Mutex
+	errQueue    []reportedError //protected by errLocker 等待调用ErrorHandler的错误
+	dispatching int32           //atomic 是否有routine正在调用ErrorHandler
+
+	closeOnce sync.Once
+	closed    chan bool //Close完成后关闭
+	closeErr  error     //关闭closed之前赋值
 }
 
 //newManager 返回Manager
@@ -33,18 +67,52 @@ func newManager(config *LogConfig, file *ConfigFile) Manager {
 		file:         file,
 		stop:         make(chan bool), //无缓冲 自动会等
 		rwLocker:     &sync.RWMutex{},
+		flushLocker:  &sync.Mutex{},
 		config:       config,
 		queue:        list.New(),
 		atomicLocker: 0,
+		closed:       make(chan bool),
 	}
+	mr.errorHandler.Store(ErrorHandler(defaultErrorHandler))
+	prepareLayouts(config, nil)
+	mr.handler.Store(mr.buildHandler(config))
 	mr.startLoop()
-	mr.file.StartMonitor(mr.Reload)
+	mr.file.StartMonitor(mr.Reload, func(err error) {
+		atomic.AddUint64(&mr.metrics.reloadFailures, 1)
+		mr.reportError(nil, err)
+		mr.dispatchErrors()
+	})
 	return mr
 }
 
-func (m *manager) Close() {
-	m.file.StopMonitor()
-	m.stopLoop()
+func (m *manager) Close(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		go func() {
+			m.file.StopMonitor()
+			m.stop <- true //等待loop退出
+			m.closeErr = errors.Join(m.sync(), m.closeTargets())
+			close(m.closed)
+		}()
+	})
+	select {
+	case <-m.closed:
+		return m.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *manager) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- m.sync()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (m *manager) GetLogger(name string) Logger {
@@ -57,52 +125,335 @@ func (m *manager) GetLogger(name string) Logger {
 
 //Reload 重新加载Config
 func (m *manager) Reload(config *LogConfig) {
+	defer m.dispatchErrors()
 	m.stopLoop()
+	//与Use一样先mwLocker后rwLocker 处理链在rwLocker之外生成
+	m.mwLocker.Lock()
+	defer m.mwLocker.Unlock()
+	handler := m.buildHandler(config)
 	m.rwLocker.Lock()
 	defer m.rwLocker.Unlock()
 	//stopLoop后 lock前 可能已经有WriteEvent进去 要write以及flush
+	m.expireDedup(true)
 	if m.config.Async {
 		m.asyncWrite()
 	}
+	m.writeSummaries(true)
 	for _, v := range m.config.Layouts {
-		v.Target.Flush()
+		m.flushLayout(v)
 	}
+	prepareLayouts(config, m.config)
+	old := m.config
 	m.config = config
+	m.handler.Store(handler)
+	m.closeUnused(old, config)
 	m.startLoop()
+	atomic.AddUint64(&m.metrics.reloads, 1)
+}
+
+//closeUnused 关闭旧配置中不再使用的Target protected by rwLocker
+func (m *manager) closeUnused(old *LogConfig, config *LogConfig) {
+	using := make(map[Target]bool, len(config.Layouts))
+	for _, v := range config.Layouts {
+		using[v.Target] = true
+	}
+	for _, v := range old.Layouts {
+		if using[v.Target] {
+			continue
+		}
+		if err := closeTarget(v.Target); err != nil {
+			m.reportError(v, err)
+		}
+	}
+}
+
+//closeTargets Manager.Close时关闭所有Target
+func (m *manager) closeTargets() error {
+	defer m.dispatchErrors()
+	m.rwLocker.Lock()
+	defer m.rwLocker.Unlock()
+	var errs []error
+	for _, v := range m.config.Layouts {
+		if err := closeTarget(v.Target); err != nil {
+			m.reportError(v, err)
+			errs = append(errs, fmt.Errorf("%s: %w", v.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *manager) Stats() Stats {
+	stats := Stats{
+		Events:         make(map[string]uint64),
+		TargetEvents:   make(map[string]uint64),
+		TargetBytes:    make(map[string]uint64),
+		Dropped:        atomic.LoadUint64(&m.metrics.dropped),
+		Suppressed:     atomic.LoadUint64(&m.metrics.suppressed),
+		QueueDepth:     atomic.LoadInt64(&m.metrics.queueDepth),
+		Reloads:        atomic.LoadUint64(&m.metrics.reloads),
+		ReloadFailures: atomic.LoadUint64(&m.metrics.reloadFailures),
+		FlushLatency:   m.metrics.flushSnapshot(),
+	}
+	for i := range m.metrics.events {
+		if n := atomic.LoadUint64(&m.metrics.events[i]); n > 0 {
+			stats.Events[levelName(LogLevel(i))] = n
+		}
+	}
+	m.rwLocker.RLock()
+	defer m.rwLocker.RUnlock()
+	for _, v := range m.config.Layouts {
+		stats.TargetEvents[v.ID] = atomic.LoadUint64(&v.state.written)
+		if t, ok := v.Target.(StatsTarget); ok {
+			ts := t.TargetStats()
+			stats.TargetBytes[v.ID] = ts.BytesWritten
+			stats.Rotations += ts.Rotations
+			stats.Dropped += ts.Dropped
+		}
+	}
+	return stats
+}
+
+func (m *manager) SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		handler = defaultErrorHandler
+	}
+	m.errorHandler.Store(handler)
+}
+
+func (m *manager) TargetStatus() []TargetStatus {
+	m.rwLocker.RLock()
+	defer m.rwLocker.RUnlock()
+	status := make([]TargetStatus, 0, len(m.config.Layouts))
+	for _, v := range m.config.Layouts {
+		status = append(status, v.state.status(v))
+	}
+	return status
+}
+
+//reportError 记录Layout的错误 等到dispatchErrors时再调用ErrorHandler layout为nil表示不是Target的错误
+//调用时可能持有rwLocker 直接调用ErrorHandler的话 在其中写日志会死锁
+func (m *manager) reportError(layout *Layout, err error) {
+	id := ""
+	if layout != nil {
+		id = layout.ID
+		layout.state.record(err)
+	}
+	m.errLocker.Lock()
+	if len(m.errQueue) < maxQueuedErrors {
+		m.errQueue = append(m.errQueue, reportedError{id: id, err: err})
+	}
+	m.errLocker.Unlock()
+}
+
+//dispatchErrors 对reportError记录的错误调用ErrorHandler 必须在释放rwLocker之后调用
+//同一时刻只有1个routine调用ErrorHandler ErrorHandler中写日志产生的错误在下次dispatchErrors时处理
+func (m *manager) dispatchErrors() {
+	if !atomic.CompareAndSwapInt32(&m.dispatching, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&m.dispatching, 0)
+	m.errLocker.Lock()
+	queue := m.errQueue
+	m.errQueue = nil
+	m.errLocker.Unlock()
+	handler := m.errorHandler.Load().(ErrorHandler)
+	for _, v := range queue {
+		handler(v.id, v.err)
+	}
+}
+
+func (m *manager) currentConfig() *LogConfig {
+	m.rwLocker.RLock()
+	defer m.rwLocker.RUnlock()
+	return m.config
+}
+
+func (m *manager) Use(mws ...Middleware) {
+	m.mwLocker.Lock()
+	defer m.mwLocker.Unlock()
+	m.middlewares = append(m.middlewares, mws...)
+	m.handler.Store(m.buildHandler(m.currentConfig()))
 }
 
+//buildHandler 生成包括config.Middlewares和Use添加的Middleware的处理链 protected by mwLocker
+//加锁顺序为先mwLocker后rwLocker
+func (m *manager) buildHandler(config *LogConfig) Handler {
+	return chain(chain(m.write, config.Middlewares), m.middlewares)
+}
+
+//WriteEvent 合并LogConfig.Fields后交给处理链 Middleware在锁外执行 可以在其中写日志
 func (m *manager) WriteEvent(e LogEvent) {
+	defer m.dispatchErrors()
+	m.metrics.addEvent(e.Level)
+	if e.Err != nil && isNilError(e.Err) {
+		//值为nil的*MyErr 与fmt一样当作没有error
+		e.Err = nil
+	}
+	if fields := m.currentConfig().Fields; len(fields) > 0 {
+		e.Properties = mergeFields(fields, e.Properties)
+	}
+	m.handler.Load().(Handler)(&e)
+}
+
+//write 处理链的最后1步 经过logger的合并和采样后写入
+func (m *manager) write(ev *LogEvent) {
+	e := *ev
 	m.rwLocker.RLock()
 	defer m.rwLocker.RUnlock()
+	lc := m.config.loggerConfig(e.Name)
+	if lc != nil && lc.Dedup != nil {
+		lc.Dedup.push(&e, func(e *LogEvent) {
+			m.emit(lc, e)
+		})
+		return
+	}
+	m.emit(lc, &e)
+}
+
+//emit 经过logger的采样后写入异步队列或者直接写入 protected by rwLocker
+func (m *manager) emit(lc *LoggerConfig, e *LogEvent) {
+	if lc != nil && lc.Sampler != nil && !lc.Sampler.Allow(e) {
+		atomic.AddUint64(&m.metrics.suppressed, 1)
+		return
+	}
 	if m.config.Async {
-		m.asyncCache(e)
+		m.asyncCache(*e)
 	} else {
-		for _, v := range m.config.Layouts {
-			if match(&e, v.Target) {
-				v.Target.Write(&e, v.Serializer)
-			}
+		m.writeLayouts(e, true)
+	}
+}
+
+//expireDedup 输出合并后到期的日志 force时全部输出 在写入异步队列之前调用
+func (m *manager) expireDedup(force bool) {
+	for _, lc := range m.config.Loggers {
+		if lc == nil || lc.Dedup == nil {
+			continue
+		}
+		lc.Dedup.expire(force, func(e *LogEvent) {
+			m.emit(lc, e)
+		})
+	}
+}
+
+//writeLayouts 写入所有匹配的Layout sample为false时不经过Layout的采样 用于logger的汇总
+func (m *manager) writeLayouts(e *LogEvent, sample bool) {
+	for _, v := range m.config.Layouts {
+		if !match(e, v.Target) || (v.Filter != nil && !v.Filter.Match(e)) {
+			continue
+		}
+		if sample && v.Sampler != nil && !v.Sampler.Allow(e) {
+			atomic.AddUint64(&m.metrics.suppressed, 1)
+			continue
 		}
+		m.writeLayout(v, e)
+	}
+}
+
+//writeLayout 写入1个Layout 并统计写入成功或者丢弃
+func (m *manager) writeLayout(v *Layout, e *LogEvent) {
+	if v.Redactor != nil {
+		e = v.Redactor.Redact(e)
+	}
+	if t, ok := v.Target.(ErrorTarget); ok {
+		if err := t.TryWrite(e, v.Serializer); err != nil {
+			atomic.AddUint64(&m.metrics.dropped, 1)
+			m.reportError(v, err)
+			return
+		}
+	} else {
+		v.Target.Write(e, v.Serializer)
+	}
+	atomic.AddUint64(&v.state.written, 1)
+}
+
+//writeSummaries 输出采样丢弃的汇总 logger的汇总写入所有匹配的Layout Layout的汇总只写入该Layout
+func (m *manager) writeSummaries(force bool) {
+	for _, lc := range m.config.Loggers {
+		if lc == nil || lc.Sampler == nil {
+			continue
+		}
+		for _, e := range lc.Sampler.summary(force) {
+			m.writeLayouts(e, false)
+		}
+	}
+	for _, v := range m.config.Layouts {
+		if v.Sampler == nil {
+			continue
+		}
+		for _, e := range v.Sampler.summary(force) {
+			m.writeLayout(v, e)
+		}
+	}
+}
+
+//flushLayout 刷新Layout的Target 实现了Syncer的Target返回错误
+func (m *manager) flushLayout(v *Layout) error {
+	start := time.Now()
+	defer func() {
+		m.metrics.observeFlush(time.Since(start))
+	}()
+	s, ok := v.Target.(Syncer)
+	if !ok {
+		v.Target.Flush()
+		return nil
 	}
+	err := s.Sync()
+	if err != nil {
+		m.reportError(v, err)
+	}
+	return err
 }
 
 func (m *manager) flush(force bool) {
+	defer m.dispatchErrors()
 	defer func() {
 		//保证外围循环不会挂掉
 		if err := recover(); err != nil {
-			log.Println("flush 0:", err)
+			m.reportError(nil, fmt.Errorf("flush: %+v", err))
 		}
 	}()
 	m.rwLocker.RLock()
 	defer m.rwLocker.RUnlock()
+	m.flushLocker.Lock()
+	defer m.flushLocker.Unlock()
 
+	m.expireDedup(false)
 	if m.config.Async {
 		m.asyncWrite()
 	}
+	m.writeSummaries(false)
 	for _, v := range m.config.Layouts {
 		if force || v.Target.Overflow() {
-			v.Target.Flush()
+			m.flushLayout(v)
+		}
+	}
+}
+
+//sync 写入异步队列并同步所有Target 汇总Syncer返回的错误
+func (m *manager) sync() (e error) {
+	defer m.dispatchErrors()
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("%+v", err)
+		}
+	}()
+	m.rwLocker.RLock()
+	defer m.rwLocker.RUnlock()
+	m.flushLocker.Lock()
+	defer m.flushLocker.Unlock()
+
+	m.expireDedup(true)
+	if m.config.Async {
+		m.asyncWrite()
+	}
+	m.writeSummaries(true)
+	var errs []error
+	for _, v := range m.config.Layouts {
+		if err := m.flushLayout(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.ID, err))
 		}
 	}
+	return errors.Join(errs...)
 }
 
 func (m *manager) startLoop() {
@@ -127,6 +478,7 @@ func (m *manager) asyncCache(e LogEvent) {
 	m.atomicLock()
 	m.queue.PushBack(&e)
 	m.atomicUnLock()
+	atomic.AddInt64(&m.metrics.queueDepth, 1)
 }
 
 func (m *manager) asyncWrite() {
@@ -151,12 +503,8 @@ func (m *manager) asyncWrite() {
 		}
 		node := queue.Front()
 		queue.Remove(node)
-		e := node.Value.(*LogEvent)
-		for _, v := range m.config.Layouts {
-			if match(e, v.Target) {
-				v.Target.Write(e, v.Serializer)
-			}
-		}
+		atomic.AddInt64(&m.metrics.queueDepth, -1)
+		m.writeLayouts(node.Value.(*LogEvent), true)
 	}
 }
 
@@ -172,6 +520,27 @@ func (m *manager) atomicUnLock() {
 	atomic.AddInt64(&m.atomicLocker, -1)
 }
 
+//prepareLayouts 补全Layout的ID 重新加载时沿用旧配置中相同ID的错误统计
+func prepareLayouts(config *LogConfig, old *LogConfig) {
+	states := make(map[string]*layoutState)
+	if old != nil {
+		for _, v := range old.Layouts {
+			states[v.ID] = v.state
+		}
+	}
+	for i, v := range config.Layouts {
+		if v.ID == "" {
+			v.ID = fmt.Sprintf("layout#%d", i)
+		}
+		if v.state == nil {
+			v.state = states[v.ID]
+		}
+		if v.state == nil {
+			v.state = &layoutState{}
+		}
+	}
+}
+
 func match(event *LogEvent, t Target) bool {
 	return (t.Name() == "*" || event.Name == t.Name()) &&
 		(t.MaxLevel() == EveryLevel || event.Level <= t.MaxLevel()) &&
@@ -0,0 +1,171 @@
+package glog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+//runWithTimeout 在超时时间内没有完成时认为死锁
+func runWithTimeout(t *testing.T, d time.Duration, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatal("deadlock")
+	}
+}
+
+func TestErrorHandlerCanLog(t *testing.T) {
+	config := NewLogConfig()
+	config.Layouts = []*Layout{{
+		ID:         "broken",
+		Target:     NewWriterTarget(failingWriter{}, WriterOptions{BufferSize: 1024}),
+		Serializer: &DefaultSerializer{},
+	}}
+	m := NewWithConfig(config)
+	defer m.Close(context.Background())
+
+	logger := m.GetLogger("app")
+	var calls int32
+	m.SetErrorHandler(func(targetName string, err error) {
+		atomic.AddInt32(&calls, 1)
+		logger.Warnf("target %s failed: %v", targetName, err)
+	})
+	runWithTimeout(t, 5*time.Second, func() {
+		logger.Info("hello")
+		if err := m.Flush(context.Background()); err == nil {
+			t.Error("Flush should return the write error")
+		}
+		m.(*manager).Reload(config)
+		m.Flush(context.Background())
+	})
+	if atomic.LoadInt32(&calls) == 0 {
+		t.Fatal("ErrorHandler not called")
+	}
+	if status := m.TargetStatus(); status[0].ErrorCount == 0 {
+		t.Fatalf("TargetStatus = %+v", status)
+	}
+}
+
+//closingTarget 记录Close调用次数的Target
+type closingTarget struct {
+	targetFilter
+	closed int32 //atomic
+}
+
+func newClosingTarget() *closingTarget {
+	return &closingTarget{targetFilter: targetFilter{name: "*"}}
+}
+
+func (ct *closingTarget) Write(event *LogEvent, sr Serializer) {}
+
+func (ct *closingTarget) Overflow() bool {
+	return false
+}
+
+func (ct *closingTarget) Flush() {}
+
+func (ct *closingTarget) Close() error {
+	atomic.AddInt32(&ct.closed, 1)
+	return nil
+}
+
+func TestCloseTargets(t *testing.T) {
+	kept, dropped, added := newClosingTarget(), newClosingTarget(), newClosingTarget()
+	config := NewLogConfig()
+	config.Layouts = []*Layout{
+		{Target: kept, Serializer: &DefaultSerializer{}},
+		{Target: dropped, Serializer: &DefaultSerializer{}},
+	}
+	m := NewWithConfig(config)
+
+	reloaded := NewLogConfig()
+	reloaded.Layouts = []*Layout{
+		{Target: kept, Serializer: &DefaultSerializer{}},
+		{Target: added, Serializer: &DefaultSerializer{}},
+	}
+	m.(*manager).Reload(reloaded)
+	if kept.closed != 0 || dropped.closed != 1 || added.closed != 0 {
+		t.Fatalf("after Reload closed = %d %d %d", kept.closed, dropped.closed, added.closed)
+	}
+	m.Close(context.Background())
+	m.Close(context.Background())
+	if kept.closed != 1 || dropped.closed != 1 || added.closed != 1 {
+		t.Fatalf("after Close closed = %d %d %d", kept.closed, dropped.closed, added.closed)
+	}
+}
+
+//slowTarget Flush时等待 放大Reload持有rwLocker的时间
+type slowTarget struct {
+	closingTarget
+}
+
+func (st *slowTarget) Flush() {
+	time.Sleep(time.Millisecond)
+}
+
+func TestUseDuringReload(t *testing.T) {
+	config := NewLogConfig()
+	config.Layouts = []*Layout{{
+		Target:     &slowTarget{closingTarget: *newClosingTarget()},
+		Serializer: &DefaultSerializer{},
+	}}
+	m := NewWithConfig(config).(*manager)
+	defer func() {
+		//死锁时Close也无法完成
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		m.Close(ctx)
+	}()
+
+	var calls int32
+	mw := func(next Handler) Handler {
+		return func(e *LogEvent) {
+			atomic.AddInt32(&calls, 1)
+			next(e)
+		}
+	}
+	var added int32
+	runWithTimeout(t, 10*time.Second, func() {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for added < 1000 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m.Use(mw)
+				added++
+				time.Sleep(10 * time.Microsecond)
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			m.Reload(config)
+		}
+		close(stop)
+		<-done
+	})
+	//Reload后仍然保留Use添加的Middleware
+	m.Reload(config)
+	m.GetLogger("app").Info("hello")
+	if n := atomic.LoadInt32(&calls); n != added {
+		t.Fatalf("middleware called %d times, want %d", n, added)
+	}
+}
@@ -0,0 +1,237 @@
+package glog
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//MemoryQuery 查询MemoryTarget中的日志 零值表示不过滤
+type MemoryQuery struct {
+	MinLevel LogLevel
+	Name     string
+	Since    time.Time
+	Limit    int //只返回最近的Limit条
+}
+
+//memoryEntry 保存LogEvent以及序列化后的大小
+type memoryEntry struct {
+	event LogEvent
+	size  int
+}
+
+//memoryRing 环形缓冲区 超过maxEvents条或者maxBytes字节时丢弃最早的日志
+type memoryRing struct {
+	locker    sync.Mutex
+	entries   []memoryEntry //protected by locker
+	head      int           //protected by locker 最早的日志的位置
+	count     int           //protected by locker
+	bytes     int           //protected by locker
+	maxEvents int           //protected by locker 0表示不限制
+	maxBytes  int           //protected by locker 0表示不限制
+}
+
+func (mr *memoryRing) limitBytes() bool {
+	mr.locker.Lock()
+	defer mr.locker.Unlock()
+	return mr.maxBytes > 0
+}
+
+func (mr *memoryRing) push(e memoryEntry) {
+	mr.locker.Lock()
+	defer mr.locker.Unlock()
+	if mr.count == len(mr.entries) {
+		mr.grow()
+	}
+	mr.entries[(mr.head+mr.count)%len(mr.entries)] = e
+	mr.count++
+	mr.bytes += e.size
+	mr.trim()
+}
+
+//grow 按顺序复制到更大的数组 数量达到maxEvents后不再增长
+func (mr *memoryRing) grow() {
+	size := len(mr.entries) * 2
+	if size == 0 {
+		size = 64
+	}
+	if mr.maxEvents > 0 && size > mr.maxEvents {
+		size = mr.maxEvents
+	}
+	if size <= len(mr.entries) {
+		//已经达到maxEvents 丢弃最早的1条
+		mr.pop()
+		return
+	}
+	entries := make([]memoryEntry, size)
+	for i := 0; i < mr.count; i++ {
+		entries[i] = mr.entries[(mr.head+i)%len(mr.entries)]
+	}
+	mr.entries = entries
+	mr.head = 0
+}
+
+func (mr *memoryRing) pop() {
+	mr.bytes -= mr.entries[mr.head].size
+	mr.entries[mr.head] = memoryEntry{}
+	mr.head = (mr.head + 1) % len(mr.entries)
+	mr.count--
+}
+
+func (mr *memoryRing) trim() {
+	for mr.count > 0 && ((mr.maxEvents > 0 && mr.count > mr.maxEvents) || (mr.maxBytes > 0 && mr.bytes > mr.maxBytes)) {
+		mr.pop()
+	}
+}
+
+func (mr *memoryRing) resize(maxEvents int, maxBytes int) {
+	mr.locker.Lock()
+	defer mr.locker.Unlock()
+	mr.maxEvents = maxEvents
+	mr.maxBytes = maxBytes
+	mr.trim()
+	if maxEvents > 0 && len(mr.entries) > maxEvents {
+		entries := make([]memoryEntry, maxEvents)
+		for i := 0; i < mr.count; i++ {
+			entries[i] = mr.entries[(mr.head+i)%len(mr.entries)]
+		}
+		mr.entries = entries
+		mr.head = 0
+	}
+}
+
+func (mr *memoryRing) query(q MemoryQuery) []LogEvent {
+	mr.locker.Lock()
+	defer mr.locker.Unlock()
+	var events []LogEvent
+	for i := 0; i < mr.count; i++ {
+		e := &mr.entries[(mr.head+i)%len(mr.entries)].event
+		if (q.MinLevel != EveryLevel && e.Level < q.MinLevel) ||
+			(q.Name != "" && e.Name != q.Name) ||
+			(!q.Since.IsZero() && eventTime(e).Before(q.Since)) {
+			continue
+		}
+		events = append(events, copyEvent(e))
+	}
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events
+}
+
+//MemoryTarget 在内存中保留最近的日志 可以通过Events或者http查询
+type MemoryTarget struct {
+	targetFilter
+	ring *memoryRing
+}
+
+var (
+	memoryTargetsLocker sync.Mutex
+	memoryTargets       = make(map[string]*MemoryTarget)
+)
+
+//GetMemoryTarget 返回配置中Key对应的MemoryTarget 不存在时返回nil
+func GetMemoryTarget(key string) *MemoryTarget {
+	memoryTargetsLocker.Lock()
+	defer memoryTargetsLocker.Unlock()
+	return memoryTargets[key]
+}
+
+//Write 保存LogEvent的副本 序列化的结果只用于计算大小
+func (mt *MemoryTarget) Write(event *LogEvent, sr Serializer) {
+	e := copyEvent(event)
+	size := 0
+	if mt.ring.limitBytes() {
+		size = len(sr.Encode(event))
+	}
+	mt.ring.push(memoryEntry{event: e, size: size})
+}
+
+func (mt *MemoryTarget) Overflow() bool {
+	return false
+}
+
+func (mt *MemoryTarget) Flush() {
+}
+
+//Events 按时间顺序返回符合条件的日志 返回副本 修改不影响保存的日志
+func (mt *MemoryTarget) Events(q MemoryQuery) []LogEvent {
+	return mt.ring.query(q)
+}
+
+//ServeHTTP 支持的参数 level=Warn name=db since=5m(或RFC3339时间) limit=100 format=json|text
+func (mt *MemoryTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q := MemoryQuery{
+		MinLevel: toLevel(values.Get("level")),
+		Name:     values.Get("name"),
+	}
+	if since := values.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			q.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			q.Since = t
+		} else {
+			http.Error(w, "invalid since: "+since, http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "invalid limit: "+limit, http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+	events := mt.Events(q)
+	var buf bytes.Buffer
+	if values.Get("format") == "text" {
+		sr := findSerializer("plain")
+		for i := range events {
+			buf.Write(sr.Encode(&events[i]))
+			buf.WriteByte('\n')
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		sr := findSerializer("json")
+		buf.WriteByte('[')
+		for i := range events {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(sr.Encode(&events[i]))
+		}
+		buf.WriteByte(']')
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(buf.Bytes())
+}
+
+//createMemoryTarget 相同Key的MemoryTarget在重新加载时沿用之前的日志
+func createMemoryTarget(config map[string]interface{}) Target {
+	key := configString(config, "Key", "memory")
+	maxEvents := configInt(config, "MaxEvents", 0)
+	maxBytes := configInt(config, "MaxBytes", 0)
+	if maxEvents <= 0 && maxBytes <= 0 {
+		maxEvents = 1000
+	}
+	memoryTargetsLocker.Lock()
+	defer memoryTargetsLocker.Unlock()
+	mt := &MemoryTarget{
+		targetFilter: newTargetFilter(config),
+	}
+	if old, ok := memoryTargets[key]; ok {
+		mt.ring = old.ring
+		mt.ring.resize(maxEvents, maxBytes)
+	} else {
+		mt.ring = &memoryRing{
+			maxEvents: maxEvents,
+			maxBytes:  maxBytes,
+		}
+	}
+	memoryTargets[key] = mt
+	return mt
+}
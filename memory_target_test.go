@@ -0,0 +1,127 @@
+package glog
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//newTestMemoryTarget 使用测试名作为Key 结束时删除 避免-count多次运行时沿用之前的日志
+func newTestMemoryTarget(t *testing.T, config map[string]interface{}) *MemoryTarget {
+	t.Helper()
+	config["Key"] = t.Name()
+	t.Cleanup(func() {
+		memoryTargetsLocker.Lock()
+		delete(memoryTargets, t.Name())
+		memoryTargetsLocker.Unlock()
+	})
+	return createMemoryTarget(config).(*MemoryTarget)
+}
+
+func memoryMessages(events []LogEvent) []string {
+	msgs := make([]string, len(events))
+	for i := range events {
+		msgs[i] = events[i].Message()
+	}
+	return msgs
+}
+
+func TestMemoryTargetCapacity(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		want   []string
+	}{
+		{"MaxEvents", map[string]interface{}{"MaxEvents": 3}, []string{"e3", "e4", "e5"}},
+		//每条序列化后2字节
+		{"MaxBytes", map[string]interface{}{"MaxBytes": 5}, []string{"e4", "e5"}},
+		{"both", map[string]interface{}{"MaxEvents": 4, "MaxBytes": 6}, []string{"e3", "e4", "e5"}},
+		{"default", map[string]interface{}{}, []string{"e1", "e2", "e3", "e4", "e5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mt := newTestMemoryTarget(t, tt.config)
+			for _, msg := range []string{"e1", "e2", "e3", "e4", "e5"} {
+				mt.Write(testEvent(InfoLevel, "app", msg), messageSerializer{})
+			}
+			if got := memoryMessages(mt.Events(MemoryQuery{})); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTargetGrowAndResize(t *testing.T) {
+	config := map[string]interface{}{"MaxEvents": 100}
+	mt := newTestMemoryTarget(t, config)
+	var want []string
+	for i := 0; i < 150; i++ {
+		msg := strconv.Itoa(i)
+		mt.Write(testEvent(InfoLevel, "app", msg), messageSerializer{})
+		want = append(want, msg)
+	}
+	if got := memoryMessages(mt.Events(MemoryQuery{})); !reflect.DeepEqual(got, want[50:]) {
+		t.Fatalf("got %d events from %v", len(got), got[0])
+	}
+	//重新加载时沿用之前的日志 MaxEvents变小时丢弃最早的
+	config["MaxEvents"] = 10
+	mt = createMemoryTarget(config).(*MemoryTarget)
+	if got := memoryMessages(mt.Events(MemoryQuery{})); !reflect.DeepEqual(got, want[140:]) {
+		t.Fatalf("got %v", got)
+	}
+	if GetMemoryTarget(t.Name()) != mt {
+		t.Fatal("GetMemoryTarget should return the latest target")
+	}
+}
+
+func TestMemoryTargetQuery(t *testing.T) {
+	mt := newTestMemoryTarget(t, map[string]interface{}{})
+	base := time.Now()
+	for i, e := range []*LogEvent{
+		testEvent(InfoLevel, "app", "a"),
+		testEvent(WarnLevel, "db", "b"),
+		testEvent(ErrorLevel, "app", "c"),
+		testEvent(WarnLevel, "app", "d"),
+	} {
+		e.Timestamp = base.Add(time.Duration(i) * time.Second)
+		mt.Write(e, messageSerializer{})
+	}
+	tests := []struct {
+		q    MemoryQuery
+		want []string
+	}{
+		{MemoryQuery{MinLevel: WarnLevel}, []string{"b", "c", "d"}},
+		{MemoryQuery{Name: "app"}, []string{"a", "c", "d"}},
+		{MemoryQuery{Since: base.Add(2 * time.Second)}, []string{"c", "d"}},
+		{MemoryQuery{Name: "app", Limit: 2}, []string{"c", "d"}},
+	}
+	for _, tt := range tests {
+		if got := memoryMessages(mt.Events(tt.q)); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("Events(%+v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryTargetCopies(t *testing.T) {
+	mt := newTestMemoryTarget(t, map[string]interface{}{})
+	e := testEvent(InfoLevel, "app", "")
+	e.Format, e.Args = "user=%s", []interface{}{"alice"}
+	e.Properties = Properties{"user": "alice"}
+	mt.Write(e, messageSerializer{})
+	//Write之后修改原来的LogEvent不影响保存的日志
+	e.Properties["user"] = "bob"
+	e.Args[0] = "bob"
+
+	events := mt.Events(MemoryQuery{})
+	if events[0].Message() != "user=alice" || events[0].Properties["user"] != "alice" {
+		t.Fatalf("got %s %v", events[0].Message(), events[0].Properties)
+	}
+	//修改返回的副本不影响保存的日志
+	events[0].Properties["user"] = "carol"
+	events[0].Args[0] = "carol"
+	events = mt.Events(MemoryQuery{})
+	if events[0].Message() != "user=alice" || events[0].Properties["user"] != "alice" {
+		t.Fatalf("got %s %v", events[0].Message(), events[0].Properties)
+	}
+}
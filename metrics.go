@@ -0,0 +1,169 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//TargetStats Target自身的统计
+type TargetStats struct {
+	BytesWritten uint64
+	Rotations    uint64 //日志文件切换次数
+	Dropped      uint64 //写入失败丢弃的事件数
+}
+
+//StatsTarget Target可选实现 Manager.Stats会汇总这些统计
+type StatsTarget interface {
+	TargetStats() TargetStats
+}
+
+//HistogramSnapshot 直方图快照 单位为秒
+type HistogramSnapshot struct {
+	Buckets []float64 //每个桶的上界
+	Counts  []uint64  //小于等于对应上界的累计数量
+	Count   uint64
+	Sum     float64
+}
+
+//Stats Manager的统计快照
+type Stats struct {
+	Events         map[string]uint64 //按级别统计WriteEvent的事件数
+	TargetEvents   map[string]uint64 //按Layout.ID统计写入成功的事件数
+	TargetBytes    map[string]uint64 //按Layout.ID统计写入的字节数 只包括实现了StatsTarget的Target
+	Dropped        uint64            //TryWrite失败以及Target发送失败丢弃的事件数
+	Suppressed     uint64            //采样或者限速丢弃的事件数
+	QueueDepth     int64             //异步队列中等待写入的事件数
+	Rotations      uint64            //日志文件切换次数
+	Reloads        uint64            //配置重新加载成功次数
+	ReloadFailures uint64            //配置重新加载失败次数
+	FlushLatency   HistogramSnapshot //Target flush的耗时
+}
+
+//flushBuckets flush耗时直方图的上界 单位秒
+var flushBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+//metrics Manager内部的计数器
+type metrics struct {
+	events         [FatalLevel + 1]uint64 //atomic
+	dropped        uint64                 //atomic
+	suppressed     uint64                 //atomic
+	queueDepth     int64                  //atomic
+	reloads        uint64                 //atomic
+	reloadFailures uint64                 //atomic
+
+	locker       sync.Mutex
+	flushCounts  []uint64 //protected by locker 每个桶(不累计)的数量 最后1个为+Inf
+	flushCount   uint64   //protected by locker
+	flushSeconds float64  //protected by locker
+}
+
+func (ms *metrics) addEvent(level LogLevel) {
+	if level >= 0 && int(level) < len(ms.events) {
+		atomic.AddUint64(&ms.events[level], 1)
+	}
+}
+
+func (ms *metrics) observeFlush(d time.Duration) {
+	seconds := d.Seconds()
+	ms.locker.Lock()
+	defer ms.locker.Unlock()
+	if ms.flushCounts == nil {
+		ms.flushCounts = make([]uint64, len(flushBuckets)+1)
+	}
+	i := sort.SearchFloat64s(flushBuckets, seconds)
+	ms.flushCounts[i]++
+	ms.flushCount++
+	ms.flushSeconds += seconds
+}
+
+func (ms *metrics) flushSnapshot() HistogramSnapshot {
+	ms.locker.Lock()
+	defer ms.locker.Unlock()
+	h := HistogramSnapshot{
+		Buckets: append([]float64(nil), flushBuckets...),
+		Counts:  make([]uint64, len(flushBuckets)),
+		Count:   ms.flushCount,
+		Sum:     ms.flushSeconds,
+	}
+	var total uint64
+	for i := range flushBuckets {
+		if ms.flushCounts != nil {
+			total += ms.flushCounts[i]
+		}
+		h.Counts[i] = total
+	}
+	return h
+}
+
+//NewStatsHandler 返回以Prometheus文本格式输出Manager统计的http.Handler
+func NewStatsHandler(m Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writeStats(&buf, m.Stats(), m.TargetStatus())
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+func writeStats(buf *bytes.Buffer, stats Stats, status []TargetStatus) {
+	metricHeader(buf, "glog_events_total", "counter", "Events passed to the manager by level.")
+	for _, k := range sortedKeys(stats.Events) {
+		fmt.Fprintf(buf, "glog_events_total{level=\"%s\"} %d\n", escapeLabel(k), stats.Events[k])
+	}
+	metricHeader(buf, "glog_target_events_total", "counter", "Events written by target.")
+	for _, k := range sortedKeys(stats.TargetEvents) {
+		fmt.Fprintf(buf, "glog_target_events_total{target=\"%s\"} %d\n", escapeLabel(k), stats.TargetEvents[k])
+	}
+	metricHeader(buf, "glog_target_bytes_total", "counter", "Bytes written by target.")
+	for _, k := range sortedKeys(stats.TargetBytes) {
+		fmt.Fprintf(buf, "glog_target_bytes_total{target=\"%s\"} %d\n", escapeLabel(k), stats.TargetBytes[k])
+	}
+	metricHeader(buf, "glog_target_errors_total", "counter", "Write errors by target.")
+	for _, v := range status {
+		fmt.Fprintf(buf, "glog_target_errors_total{target=\"%s\"} %d\n", escapeLabel(v.ID), v.ErrorCount)
+	}
+	metricHeader(buf, "glog_dropped_events_total", "counter", "Events dropped because a target failed to accept or deliver them.")
+	fmt.Fprintf(buf, "glog_dropped_events_total %d\n", stats.Dropped)
+	metricHeader(buf, "glog_suppressed_events_total", "counter", "Events suppressed by sampling or rate limits.")
+	fmt.Fprintf(buf, "glog_suppressed_events_total %d\n", stats.Suppressed)
+	metricHeader(buf, "glog_async_queue_depth", "gauge", "Events waiting in the async queue.")
+	fmt.Fprintf(buf, "glog_async_queue_depth %d\n", stats.QueueDepth)
+	metricHeader(buf, "glog_rotations_total", "counter", "Log file rotations.")
+	fmt.Fprintf(buf, "glog_rotations_total %d\n", stats.Rotations)
+	metricHeader(buf, "glog_reloads_total", "counter", "Config reloads by result.")
+	fmt.Fprintf(buf, "glog_reloads_total{result=\"success\"} %d\n", stats.Reloads)
+	fmt.Fprintf(buf, "glog_reloads_total{result=\"failure\"} %d\n", stats.ReloadFailures)
+	metricHeader(buf, "glog_flush_duration_seconds", "histogram", "Time spent flushing targets.")
+	h := stats.FlushLatency
+	for i, le := range h.Buckets {
+		fmt.Fprintf(buf, "glog_flush_duration_seconds_bucket{le=\"%g\"} %d\n", le, h.Counts[i])
+	}
+	fmt.Fprintf(buf, "glog_flush_duration_seconds_bucket{le=\"+Inf\"} %d\n", h.Count)
+	fmt.Fprintf(buf, "glog_flush_duration_seconds_sum %g\n", h.Sum)
+	fmt.Fprintf(buf, "glog_flush_duration_seconds_count %d\n", h.Count)
+}
+
+func metricHeader(buf *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelReplacer.Replace(v)
+}
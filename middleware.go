@@ -0,0 +1,43 @@
+package glog
+
+import (
+	"fmt"
+	"sync"
+)
+
+//Handler 处理1条日志 可以修改e
+type Handler func(e *LogEvent)
+
+//Middleware 包装Handler 用于补充字段 修改 过滤(不调用next)以及统计 告警等
+//执行顺序: Manager.Use按添加顺序 然后是配置文件中的Middlewares 最后是采样 合并以及写入Target
+//Middleware中可以再写日志 但不要写入同一个logger 避免无限递归
+type Middleware func(next Handler) Handler
+
+//globalMiddleware 可以在配置文件中按名称引用的Middleware
+var globalMiddleware = make(map[string]Middleware)
+var middlewareLocker sync.RWMutex
+
+//RegisterMiddleware 添加一个Middleware 配置文件中Middlewares指定相同的name则使用这个Middleware
+func RegisterMiddleware(name string, mw Middleware) {
+	middlewareLocker.Lock()
+	defer middlewareLocker.Unlock()
+	globalMiddleware[name] = mw
+}
+
+func findMiddleware(name string) (Middleware, error) {
+	middlewareLocker.RLock()
+	defer middlewareLocker.RUnlock()
+	mw, ok := globalMiddleware[name]
+	if !ok {
+		return nil, fmt.Errorf("middleware %s not registered", name)
+	}
+	return mw, nil
+}
+
+//chain 按顺序包装handler 第1个Middleware最先执行
+func chain(handler Handler, mws []Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
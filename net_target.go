@@ -0,0 +1,425 @@
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//netTarget 把序列化后的日志通过tcp udp unix socket发送出去 如Fluent Bit Vector
+//断开期间日志缓存在内存中 超过BufferSize后写入磁盘(配置了DiskBuffer时)或者丢弃最早的日志
+//磁盘缓存只追加 记录已经发送的位置 全部发送后删除 重启后从记录的位置继续发送
+type netTarget struct {
+	targetFilter
+	conn         *netConn
+	lengthPrefix bool          //4字节大端长度前缀分帧 否则以换行分帧
+	interval     time.Duration //只读 写入的时间间隔
+	cacheSize    int           //缓存超过该大小时写入
+	bufferSize   int           //断开期间内存中最多缓存的字节数
+	disk         *netDisk      //磁盘缓存 没有配置DiskBuffer时为nil
+
+	locker       *sync.Mutex
+	incoming     [][]byte //protected by locker Write写入的消息
+	incomingSize int      //protected by locker
+
+	//以下只在Sync中访问
+	backlog       [][]byte //还没有发送成功的消息
+	backlogSize   int
+	nextWriteTime time.Time
+
+	dropped      uint64 //atomic
+	bytesWritten uint64 //atomic
+}
+
+func (nt *netTarget) Write(event *LogEvent, sr Serializer) {
+	nt.TryWrite(event, sr)
+}
+
+func (nt *netTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	frame := nt.frame(bs)
+	nt.locker.Lock()
+	nt.incoming = append(nt.incoming, frame)
+	nt.incomingSize += len(frame)
+	nt.locker.Unlock()
+	return nil
+}
+
+func (nt *netTarget) frame(bs []byte) []byte {
+	if nt.lengthPrefix {
+		frame := make([]byte, 4+len(bs))
+		binary.BigEndian.PutUint32(frame, uint32(len(bs)))
+		copy(frame[4:], bs)
+		return frame
+	}
+	frame := make([]byte, len(bs)+1)
+	copy(frame, bs)
+	frame[len(bs)] = '\n'
+	return frame
+}
+
+func (nt *netTarget) Overflow() bool {
+	nt.locker.Lock()
+	size := nt.incomingSize
+	nt.locker.Unlock()
+	return time.Now().After(nt.nextWriteTime) || size >= nt.cacheSize
+}
+
+func (nt *netTarget) Flush() {
+	nt.Sync()
+}
+
+//Sync 先发送磁盘缓存 再发送内存中的消息 失败的消息保留到下次Sync
+//有没有发送的消息时返回错误 包括等待重连期间 以及写入磁盘缓存失败时
+func (nt *netTarget) Sync() error {
+	nt.takeIncoming()
+	nt.nextWriteTime = time.Now().Add(nt.interval)
+	diskErr := nt.shrinkBacklog()
+	if len(nt.backlog) == 0 && !nt.disk.hasPending() {
+		return diskErr
+	}
+	if nt.conn.waiting() {
+		//等待重连期间不读取磁盘缓存
+		return errors.Join(diskErr, nt.conn.dial())
+	}
+	err := nt.disk.send(nt.conn, &nt.bytesWritten)
+	if err == nil {
+		err = nt.sendBacklog()
+	}
+	return errors.Join(diskErr, err)
+}
+
+//takeIncoming 把Write写入的消息移到backlog
+func (nt *netTarget) takeIncoming() {
+	nt.locker.Lock()
+	incoming := nt.incoming
+	nt.incoming = nil
+	nt.incomingSize = 0
+	nt.locker.Unlock()
+	for _, frame := range incoming {
+		nt.backlog = append(nt.backlog, frame)
+		nt.backlogSize += len(frame)
+	}
+}
+
+//Discard 丢弃内存和磁盘中没有发送的消息 由调用者重新写入
+func (nt *netTarget) Discard() {
+	nt.locker.Lock()
+	nt.incoming = nil
+	nt.incomingSize = 0
+	nt.locker.Unlock()
+	nt.backlog = nil
+	nt.backlogSize = 0
+	nt.disk.reset()
+}
+
+//Probe 没有连接时尝试连接
+func (nt *netTarget) Probe() error {
+	return nt.conn.dial()
+}
+
+//Close 关闭连接 没有发送的消息在配置了DiskBuffer时写入磁盘 由重新加载后的netTarget或者重启后发送
+//没有配置DiskBuffer时丢弃并返回错误
+func (nt *netTarget) Close() error {
+	nt.takeIncoming()
+	var err error
+	if n := len(nt.backlog); n > 0 {
+		if nt.disk != nil {
+			err = nt.appendDisk(nt.backlog)
+		} else {
+			atomic.AddUint64(&nt.dropped, uint64(n))
+			err = fmt.Errorf("netTarget %s: %d unsent messages dropped on close", nt.conn.address, n)
+		}
+		nt.backlog = nil
+		nt.backlogSize = 0
+	}
+	if nt.disk != nil {
+		err = errors.Join(err, nt.disk.release())
+	}
+	return errors.Join(err, nt.conn.shutdown())
+}
+
+func (nt *netTarget) TargetStats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&nt.bytesWritten),
+		Dropped:      atomic.LoadUint64(&nt.dropped),
+	}
+}
+
+//shrinkBacklog 内存缓存超过bufferSize时 把最早的消息移到磁盘或者丢弃
+func (nt *netTarget) shrinkBacklog() error {
+	if nt.backlogSize <= nt.bufferSize {
+		return nil
+	}
+	n := 0
+	size := nt.backlogSize
+	for n < len(nt.backlog) && size > nt.bufferSize {
+		size -= len(nt.backlog[n])
+		n++
+	}
+	var err error
+	if nt.disk != nil {
+		err = nt.appendDisk(nt.backlog[:n])
+	} else {
+		atomic.AddUint64(&nt.dropped, uint64(n))
+	}
+	nt.backlog = append([][]byte(nil), nt.backlog[n:]...)
+	nt.backlogSize = size
+	return err
+}
+
+func (nt *netTarget) sendBacklog() error {
+	for len(nt.backlog) > 0 {
+		frame := nt.backlog[0]
+		if err := nt.conn.write(frame); err != nil {
+			return err
+		}
+		atomic.AddUint64(&nt.bytesWritten, uint64(len(frame)))
+		nt.backlog[0] = nil
+		nt.backlog = nt.backlog[1:]
+		nt.backlogSize -= len(frame)
+	}
+	nt.backlog = nil
+	return nil
+}
+
+//appendDisk 写入磁盘缓存 没有写入的消息计入dropped
+func (nt *netTarget) appendDisk(frames [][]byte) error {
+	written, err := nt.disk.append(frames)
+	if written < len(frames) {
+		atomic.AddUint64(&nt.dropped, uint64(len(frames)-written))
+	}
+	return err
+}
+
+//netDisk 1个DiskBuffer文件 重新加载配置时新旧netTarget使用同一个netDisk
+//旧的netTarget Close时写入的消息由新的netTarget发送
+type netDisk struct {
+	file    string
+	maxSize int64 //文件大小(包括已经发送的部分)不超过该值
+	refs    int   //protected by netDisksLocker
+
+	locker  sync.Mutex
+	offset  int64 //protected by locker 已经发送的位置
+	pending bool  //protected by locker 是否有没有发送的消息
+}
+
+var (
+	netDisksLocker sync.Mutex
+	netDisks       = make(map[string]*netDisk)
+)
+
+//openNetDisk 返回file对应的netDisk 已经打开时增加引用计数 否则读取上次运行时没有发送完的磁盘缓存
+func openNetDisk(file string, maxSize int64) *netDisk {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	netDisksLocker.Lock()
+	defer netDisksLocker.Unlock()
+	if d, ok := netDisks[file]; ok {
+		d.refs++
+		return d
+	}
+	d := &netDisk{file: file, maxSize: maxSize, refs: 1}
+	d.open()
+	netDisks[file] = d
+	return d
+}
+
+//release 减少引用计数 为0时不再共享 文件保留到下次打开
+func (d *netDisk) release() error {
+	netDisksLocker.Lock()
+	defer netDisksLocker.Unlock()
+	d.refs--
+	if d.refs > 0 {
+		return nil
+	}
+	delete(netDisks, d.file)
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	if d.pending && d.offset > 0 {
+		return d.saveOffset()
+	}
+	return nil
+}
+
+func (d *netDisk) hasPending() bool {
+	if d == nil {
+		return false
+	}
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	return d.pending
+}
+
+//append 磁盘缓存的格式为 4字节大端长度+消息 返回写入的条数
+func (d *netDisk) append(frames [][]byte) (int, error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	var size int64
+	if stat, err := os.Stat(d.file); err == nil {
+		size = stat.Size()
+	}
+	var buf bytes.Buffer
+	var header [4]byte
+	n := 0
+	for _, frame := range frames {
+		if size+int64(buf.Len()+len(frame)+4) > d.maxSize {
+			break
+		}
+		binary.BigEndian.PutUint32(header[:], uint32(len(frame)))
+		buf.Write(header[:])
+		buf.Write(frame)
+		n++
+	}
+	var err error
+	if n < len(frames) {
+		err = fmt.Errorf("netTarget disk buffer %s full: %d messages dropped", d.file, len(frames)-n)
+	}
+	if n == 0 {
+		return 0, err
+	}
+	f, openErr := os.OpenFile(d.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.ModePerm)
+	if openErr != nil {
+		return 0, openErr
+	}
+	defer f.Close()
+	if _, writeErr := f.Write(buf.Bytes()); writeErr != nil {
+		//写入不完整时截断 避免后面的消息无法读取
+		f.Truncate(size)
+		return 0, writeErr
+	}
+	d.pending = true
+	return n, err
+}
+
+//send 从offset开始发送磁盘缓存 失败时记录已经发送的位置 全部发送后删除
+func (d *netDisk) send(conn *netConn, bytesWritten *uint64) error {
+	if d == nil {
+		return nil
+	}
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	if !d.pending {
+		return nil
+	}
+	f, err := os.Open(d.file)
+	if os.IsNotExist(err) {
+		d.remove()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = d.sendFrom(f, conn, bytesWritten)
+	f.Close()
+	if err != nil {
+		return errors.Join(err, d.saveOffset())
+	}
+	d.remove()
+	return nil
+}
+
+//sendFrom 发送offset之后的消息 末尾不完整的消息(如进程崩溃)忽略 protected by locker
+func (d *netDisk) sendFrom(f *os.File, conn *netConn, bytesWritten *uint64) error {
+	if _, err := f.Seek(d.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil
+		}
+		if err := conn.write(frame); err != nil {
+			return err
+		}
+		atomic.AddUint64(bytesWritten, uint64(len(frame)))
+		d.offset += int64(len(frame) + 4)
+	}
+}
+
+//reset 丢弃磁盘缓存
+func (d *netDisk) reset() {
+	if d == nil {
+		return
+	}
+	d.locker.Lock()
+	defer d.locker.Unlock()
+	d.remove()
+}
+
+//remove 磁盘缓存全部发送后删除 protected by locker
+func (d *netDisk) remove() {
+	os.Remove(d.file)
+	os.Remove(d.file + ".offset")
+	d.offset = 0
+	d.pending = false
+}
+
+//saveOffset 写入已经发送的位置 protected by locker
+func (d *netDisk) saveOffset() error {
+	content := []byte(strconv.FormatInt(d.offset, 10))
+	return os.WriteFile(d.file+".offset", content, os.ModePerm)
+}
+
+//open 读取上次运行时没有发送完的磁盘缓存
+func (d *netDisk) open() {
+	stat, err := os.Stat(d.file)
+	if err != nil {
+		return
+	}
+	if content, err := os.ReadFile(d.file + ".offset"); err == nil {
+		d.offset, _ = strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	}
+	if d.offset < 0 || d.offset > stat.Size() {
+		d.offset = 0
+	}
+	d.pending = stat.Size() > d.offset
+}
+
+func createNetTarget(config map[string]interface{}) Target {
+	nt := &netTarget{
+		targetFilter: newTargetFilter(config),
+		lengthPrefix: configString(config, "Framing", "newline") == "length",
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 1024*8),
+		bufferSize:   configInt(config, "BufferSize", 1024*1024*8),
+		locker:       &sync.Mutex{},
+	}
+	conn, err := newNetConn(config, "tcp", "")
+	if err != nil {
+		log.Println("createNetTarget:", err)
+		return nil
+	}
+	nt.conn = conn
+	if dir := configString(config, "DiskBuffer", ""); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			log.Println("createNetTarget:path ", dir, " ", err)
+			return nil
+		}
+		name := strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(conn.network + "-" + conn.address)
+		nt.disk = openNetDisk(path.Join(dir, name+".buf"), int64(configInt(config, "DiskBufferSize", 1024*1024*100)))
+	}
+	nt.nextWriteTime = time.Now().Add(nt.interval)
+	return nt
+}
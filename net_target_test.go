@@ -0,0 +1,222 @@
+package glog
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetTargetDiskBufferOutage(t *testing.T) {
+	//先占用1个端口再关闭 发送时连接失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	nt := createNetTarget(map[string]interface{}{
+		"Address":    address,
+		"BufferSize": 1,
+		"DiskBuffer": dir,
+		"RetryMin":   "20ms",
+		"RetryMax":   "20ms",
+	}).(*netTarget)
+	defer nt.Close()
+
+	var want []string
+	write := func(msg string) {
+		nt.TryWrite(testEvent(InfoLevel, "app", msg), messageSerializer{})
+		want = append(want, msg)
+	}
+	write("first")
+	if err := nt.Sync(); err == nil {
+		t.Fatal("Sync should fail when the collector is down")
+	}
+	before, err := os.Stat(nt.disk.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//等待重连期间只追加磁盘缓存 不重写
+	for i := 0; i < 3; i++ {
+		write("during outage")
+		if err := nt.Sync(); !errors.Is(err, errBackoff) {
+			t.Fatalf("Sync = %v, want errBackoff", err)
+		}
+	}
+	after, err := os.Stat(nt.disk.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || after.Size() <= before.Size() {
+		t.Fatalf("disk buffer rewritten: %d -> %d", before.Size(), after.Size())
+	}
+
+	ln, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skip("address reused:", err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4096)
+		var content []byte
+		for strings.Count(string(content), "\n") < len(want) {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			content = append(content, buf[:n]...)
+		}
+		received <- string(content)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	if err := nt.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	got := <-received
+	if got != strings.Join(want, "\n")+"\n" {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := os.Stat(nt.disk.file); !os.IsNotExist(err) {
+		t.Fatalf("disk buffer not removed: %v", err)
+	}
+}
+
+func TestNetTargetDiskOffset(t *testing.T) {
+	dir := t.TempDir()
+	config := map[string]interface{}{
+		"Address":    "127.0.0.1:1",
+		"DiskBuffer": dir,
+	}
+	nt := createNetTarget(config).(*netTarget)
+	if err := nt.appendDisk([][]byte{[]byte("a\n"), []byte("b\n")}); err != nil {
+		t.Fatal(err)
+	}
+	nt.disk.offset = 6
+	nt.Close()
+
+	//重启后从记录的位置继续
+	nt = createNetTarget(config).(*netTarget)
+	defer nt.Close()
+	if !nt.disk.pending || nt.disk.offset != 6 {
+		t.Fatalf("pending = %v offset = %d", nt.disk.pending, nt.disk.offset)
+	}
+}
+
+//unsentTarget 连接失败 消息留在backlog中
+func unsentTarget(t *testing.T, config map[string]interface{}, msgs ...string) *netTarget {
+	t.Helper()
+	config["Address"] = "127.0.0.1:1"
+	config["RetryMin"] = "1h"
+	nt := createNetTarget(config).(*netTarget)
+	for _, msg := range msgs {
+		nt.TryWrite(testEvent(InfoLevel, "app", msg), messageSerializer{})
+	}
+	if err := nt.Sync(); err == nil {
+		t.Fatal("Sync should fail when the collector is down")
+	}
+	return nt
+}
+
+func TestNetTargetCloseDiskBuffer(t *testing.T) {
+	dir := t.TempDir()
+	config := map[string]interface{}{"DiskBuffer": dir}
+	old := unsentTarget(t, config, "a", "b")
+
+	//重新加载配置时 新的Target在旧的Target关闭前创建 发送旧的Target写入磁盘的消息
+	nt := createNetTarget(config).(*netTarget)
+	defer nt.Close()
+	if nt.disk != old.disk {
+		t.Fatal("netTargets with the same DiskBuffer should share the disk buffer")
+	}
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !nt.disk.hasPending() {
+		t.Fatal("unsent messages should be written to disk on Close")
+	}
+	frames := readNetDisk(t, nt.disk.file)
+	if strings.Join(frames, "") != "a\nb\n" {
+		t.Fatalf("disk buffer = %q", frames)
+	}
+	if stats := old.TargetStats(); stats.Dropped != 0 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+}
+
+func readNetDisk(t *testing.T, file string) []string {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []string
+	for len(content) >= 4 {
+		size := int(binary.BigEndian.Uint32(content))
+		frames = append(frames, string(content[4:4+size]))
+		content = content[4+size:]
+	}
+	return frames
+}
+
+func TestNetTargetCloseDropped(t *testing.T) {
+	nt := unsentTarget(t, map[string]interface{}{}, "a", "b")
+	if err := nt.Close(); err == nil {
+		t.Fatal("Close should report unsent messages")
+	}
+	if stats := nt.TargetStats(); stats.Dropped != 2 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+}
+
+func TestNetTargetDiskBufferErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		block   bool //在磁盘缓存的位置创建目录 写入失败
+		dropped uint64
+		err     string
+	}{
+		{"disk buffer full", 10, false, 2, "full"},
+		{"write failed", 1 << 20, true, 3, "is a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := map[string]interface{}{
+				"Address":        "127.0.0.1:1",
+				"RetryMin":       "1h",
+				"BufferSize":     1,
+				"DiskBuffer":     dir,
+				"DiskBufferSize": tt.size,
+			}
+			nt := createNetTarget(config).(*netTarget)
+			defer nt.Close()
+			if tt.block {
+				if err := os.Mkdir(nt.disk.file, os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, msg := range []string{"a", "b", "c"} {
+				nt.TryWrite(testEvent(InfoLevel, "app", msg), messageSerializer{})
+			}
+			if err := nt.Sync(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Sync = %v, want %q", err, tt.err)
+			}
+			if stats := nt.TargetStats(); stats.Dropped != tt.dropped {
+				t.Fatalf("Dropped = %d, want %d", stats.Dropped, tt.dropped)
+			}
+		})
+	}
+}
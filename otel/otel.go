@@ -0,0 +1,62 @@
+//Package otel 把OpenTelemetry的trace和glog的日志关联起来
+//通过Logger.WithContext(ctx)传入带span的context 导入该包后可以在配置文件中使用
+//"Middlewares": ["otel"] 或者 ["otel-errors"](同时把Error及以上级别的日志记录为span事件)
+package otel
+
+import (
+	"github.com/dalixu/glog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	glog.RegisterMiddleware("otel", Middleware(false))
+	glog.RegisterMiddleware("otel-errors", Middleware(true))
+}
+
+//Middleware 从LogEvent.Context读取span 在Properties中添加trace_id span_id trace_flags
+//recordErrors为true时 Error及以上级别的日志同时记录为span事件 附带error时使用RecordError
+func Middleware(recordErrors bool) glog.Middleware {
+	return func(next glog.Handler) glog.Handler {
+		return func(e *glog.LogEvent) {
+			if e.Context != nil {
+				annotate(e, recordErrors)
+			}
+			next(e)
+		}
+	}
+}
+
+func annotate(e *glog.LogEvent, recordErrors bool) {
+	sc := trace.SpanContextFromContext(e.Context)
+	if !sc.IsValid() {
+		return
+	}
+	//Properties可能被多条日志共用 复制后再修改
+	props := make(glog.Properties, len(e.Properties)+3)
+	for k, v := range e.Properties {
+		props[k] = v
+	}
+	props["trace_id"] = sc.TraceID().String()
+	props["span_id"] = sc.SpanID().String()
+	props["trace_flags"] = sc.TraceFlags().String()
+	e.Properties = props
+
+	if !recordErrors || e.Level < glog.ErrorLevel {
+		return
+	}
+	span := trace.SpanFromContext(e.Context)
+	if !span.IsRecording() {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("log.severity", e.LevelDesc),
+		attribute.String("log.message", e.Message()),
+		attribute.String("log.logger", e.Name),
+	}
+	if e.Err != nil {
+		span.RecordError(e.Err, trace.WithAttributes(attrs...))
+		return
+	}
+	span.AddEvent("log", trace.WithAttributes(attrs...))
+}
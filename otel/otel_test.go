@@ -0,0 +1,96 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dalixu/glog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//handle 经过Middleware后返回交给下一步的LogEvent
+func handle(recordErrors bool, e *glog.LogEvent) *glog.LogEvent {
+	var got *glog.LogEvent
+	Middleware(recordErrors)(func(e *glog.LogEvent) { got = e })(e)
+	return got
+}
+
+func spanContext(t *testing.T) trace.SpanContext {
+	t.Helper()
+	traceID, err := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spanID, err := trace.SpanIDFromHex("0102030405060708")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestMiddlewareTraceIDs(t *testing.T) {
+	shared := glog.Properties{"user": "alice"}
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext(t))
+	e := handle(false, &glog.LogEvent{Level: glog.InfoLevel, Properties: shared, Context: ctx})
+	want := map[string]string{
+		"trace_id":    "0102030405060708090a0b0c0d0e0f10",
+		"span_id":     "0102030405060708",
+		"trace_flags": "01",
+		"user":        "alice",
+	}
+	for k, v := range want {
+		if e.Properties[k] != v {
+			t.Fatalf("%s = %v, want %s", k, e.Properties[k], v)
+		}
+	}
+	//多条日志共用的Properties不被修改
+	if len(shared) != 1 {
+		t.Fatalf("shared Properties modified: %v", shared)
+	}
+}
+
+func TestMiddlewareNoSpan(t *testing.T) {
+	for name, ctx := range map[string]context.Context{
+		"nil context":  nil,
+		"no span":      context.Background(),
+		"invalid span": trace.ContextWithSpanContext(context.Background(), trace.SpanContext{}),
+	} {
+		e := handle(false, &glog.LogEvent{Level: glog.InfoLevel, Context: ctx})
+		if e.Properties != nil {
+			t.Fatalf("%s: Properties = %v", name, e.Properties)
+		}
+	}
+}
+
+func TestMiddlewareRecordErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+	handle(true, &glog.LogEvent{Level: glog.InfoLevel, Name: "app", Args: []interface{}{"ignored"}, Context: ctx})
+	handle(true, &glog.LogEvent{Level: glog.ErrorLevel, Name: "app", Args: []interface{}{"no error"}, Context: ctx})
+	handle(true, &glog.LogEvent{Level: glog.ErrorLevel, Name: "app", Args: []interface{}{"failed"}, Err: errors.New("timeout"), Context: ctx})
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	events := spans[0].Events()
+	if len(events) != 2 || events[0].Name != "log" || events[1].Name != "exception" {
+		t.Fatalf("events = %+v", events)
+	}
+	attrs := make(map[string]string)
+	for _, kv := range events[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["log.message"] != "no error" || attrs["log.logger"] != "app" {
+		t.Fatalf("attributes = %v", attrs)
+	}
+}
@@ -0,0 +1,449 @@
+package glog
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//otlpKV OTLP的KeyValue value为string bool int64 float64 []byte []interface{} []otlpKV之一
+type otlpKV struct {
+	key   string
+	value interface{}
+}
+
+//otlpRecord 写入时转换好的LogRecord 不再引用LogEvent
+type otlpRecord struct {
+	scope        string
+	time         uint64
+	observedTime uint64
+	severity     int
+	severityText string
+	body         string
+	attributes   []otlpKV
+	traceID      []byte
+	spanID       []byte
+	flags        uint32
+}
+
+//otlpTarget 把日志转换成OTLP LogRecord 通过OTLP/HTTP批量发送到OpenTelemetry Collector
+//不使用Serializer 编码为protobuf(默认)或者json logger的Name作为InstrumentationScope
+type otlpTarget struct {
+	targetFilter
+	sender    *httpSender
+	json      bool          //使用OTLP/JSON编码 否则为protobuf
+	resource  []otlpKV      //只读 Resource的attributes
+	interval  time.Duration //只读 写入的时间间隔
+	cacheSize int           //缓存的条数超过该值时发送
+
+	locker  *sync.Mutex
+	pending []*otlpRecord //protected by locker
+
+	nextWriteTime time.Time
+}
+
+func (ot *otlpTarget) Write(event *LogEvent, sr Serializer) {
+	ot.TryWrite(event, sr)
+}
+
+//TryWrite spool重放时LogEvent由磁盘中保存的内容还原 没有消息时使用保存的序列化结果作为body
+func (ot *otlpTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	record := newOTLPRecord(event)
+	if raw, ok := sr.(rawSerializer); ok && record.body == "" {
+		record.body = strings.TrimRight(string(raw), "\n")
+	}
+	ot.locker.Lock()
+	ot.pending = append(ot.pending, record)
+	ot.locker.Unlock()
+	return nil
+}
+
+func newOTLPRecord(e *LogEvent) *otlpRecord {
+	desc := e.LevelDesc
+	if desc == "" {
+		desc = levelName(e.Level)
+	}
+	r := &otlpRecord{
+		scope:        e.Name,
+		time:         uint64(eventTime(e).UnixNano()),
+		observedTime: uint64(time.Now().UnixNano()),
+		severity:     otelSeverity(e.Level),
+		severityText: desc,
+		body:         e.Message(),
+		attributes:   otlpAttributes(otelAttributes(e)),
+	}
+	if s, ok := e.Properties["trace_id"].(string); ok {
+		if id, err := hex.DecodeString(s); err == nil && len(id) == 16 {
+			r.traceID = id
+		}
+	}
+	if s, ok := e.Properties["span_id"].(string); ok {
+		if id, err := hex.DecodeString(s); err == nil && len(id) == 8 {
+			r.spanID = id
+		}
+	}
+	if flags, ok := otelTraceFlags(e.Properties["trace_flags"]); ok {
+		r.flags = uint32(flags)
+	}
+	return r
+}
+
+//otlpAttributes 按key排序 保证输出稳定
+func otlpAttributes(m map[string]interface{}) []otlpKV {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKV, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKV{key: k, value: otlpValue(m[k])})
+	}
+	return kvs
+}
+
+//otlpValue 转换成AnyValue支持的类型 其他类型使用fmt.Sprint
+func otlpValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string, bool, int64, float64, []byte:
+		return t
+	case float32:
+		return float64(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	case map[string]interface{}:
+		return otlpAttributes(t)
+	case []interface{}:
+		values := make([]interface{}, len(t))
+		for i, item := range t {
+			values[i] = otlpValue(item)
+		}
+		return values
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	}
+	return fmt.Sprint(v)
+}
+
+func (ot *otlpTarget) Overflow() bool {
+	ot.locker.Lock()
+	size := len(ot.pending)
+	ot.locker.Unlock()
+	return time.Now().After(ot.nextWriteTime) || size >= ot.cacheSize
+}
+
+func (ot *otlpTarget) Flush() {
+	ot.Sync()
+}
+
+//Sync 把缓存的日志作为1个ExportLogsServiceRequest发送 失败的请求保留到之后的Sync重试 超过重试次数后丢弃
+func (ot *otlpTarget) Sync() error {
+	defer func() {
+		ot.nextWriteTime = time.Now().Add(ot.interval)
+	}()
+	return ot.sender.sync(ot.build)
+}
+
+//build 取出缓存的日志编码为请求的内容
+func (ot *otlpTarget) build() ([]byte, string, int) {
+	ot.locker.Lock()
+	pending := ot.pending
+	ot.pending = nil
+	ot.locker.Unlock()
+	if len(pending) == 0 {
+		return nil, "", 0
+	}
+	if ot.json {
+		return ot.encodeJSON(pending), "application/json", len(pending)
+	}
+	return ot.encodeProto(pending), "application/x-protobuf", len(pending)
+}
+
+//Discard 丢弃缓存以及等待重试的日志 由调用者重新写入
+func (ot *otlpTarget) Discard() {
+	ot.locker.Lock()
+	ot.pending = nil
+	ot.locker.Unlock()
+	ot.sender.reset()
+}
+
+//Close 关闭空闲的keep-alive连接
+func (ot *otlpTarget) Close() error {
+	ot.sender.client.CloseIdleConnections()
+	return nil
+}
+
+func (ot *otlpTarget) TargetStats() TargetStats {
+	return ot.sender.stats()
+}
+
+//groupByScope 按scope分组 保持第1次出现的顺序
+func groupByScope(records []*otlpRecord) ([]string, map[string][]*otlpRecord) {
+	var scopes []string
+	groups := make(map[string][]*otlpRecord)
+	for _, r := range records {
+		if _, ok := groups[r.scope]; !ok {
+			scopes = append(scopes, r.scope)
+		}
+		groups[r.scope] = append(groups[r.scope], r)
+	}
+	return scopes, groups
+}
+
+//protoWriter protobuf编码 只实现OTLP需要的部分
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(field int, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|wire))
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	w.tag(field, 0)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) fixed64(field int, v uint64) {
+	w.tag(field, 1)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+func (w *protoWriter) fixed32(field int, v uint32) {
+	w.tag(field, 5)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, v)
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.tag(field, 2)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.tag(field, 2)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+//message 编码嵌套的消息
+func (w *protoWriter) message(field int, fn func(w *protoWriter)) {
+	inner := &protoWriter{}
+	fn(inner)
+	w.bytes(field, inner.buf)
+}
+
+//anyValue opentelemetry.proto.common.v1.AnyValue
+func (w *protoWriter) anyValue(v interface{}) {
+	switch t := v.(type) {
+	case string:
+		w.string(1, t)
+	case bool:
+		b := uint64(0)
+		if t {
+			b = 1
+		}
+		w.varint(2, b)
+	case int64:
+		w.varint(3, uint64(t))
+	case float64:
+		w.fixed64(4, math.Float64bits(t))
+	case []interface{}:
+		w.message(5, func(w *protoWriter) {
+			for _, item := range t {
+				w.message(1, func(w *protoWriter) { w.anyValue(item) })
+			}
+		})
+	case []otlpKV:
+		w.message(6, func(w *protoWriter) {
+			w.keyValues(1, t)
+		})
+	case []byte:
+		w.bytes(7, t)
+	}
+}
+
+func (w *protoWriter) keyValues(field int, kvs []otlpKV) {
+	for _, kv := range kvs {
+		w.message(field, func(w *protoWriter) {
+			w.string(1, kv.key)
+			w.message(2, func(w *protoWriter) { w.anyValue(kv.value) })
+		})
+	}
+}
+
+//encodeProto 编码为opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest
+func (ot *otlpTarget) encodeProto(records []*otlpRecord) []byte {
+	scopes, groups := groupByScope(records)
+	w := &protoWriter{}
+	w.message(1, func(w *protoWriter) { //ResourceLogs
+		w.message(1, func(w *protoWriter) { //Resource
+			w.keyValues(1, ot.resource)
+		})
+		for _, scope := range scopes {
+			w.message(2, func(w *protoWriter) { //ScopeLogs
+				w.message(1, func(w *protoWriter) { //InstrumentationScope
+					if scope != "" {
+						w.string(1, scope)
+					}
+				})
+				for _, r := range groups[scope] {
+					w.message(2, func(w *protoWriter) { r.encodeProto(w) })
+				}
+			})
+		}
+	})
+	return w.buf
+}
+
+//encodeProto opentelemetry.proto.logs.v1.LogRecord
+func (r *otlpRecord) encodeProto(w *protoWriter) {
+	w.fixed64(1, r.time)
+	w.varint(2, uint64(r.severity))
+	w.string(3, r.severityText)
+	w.message(5, func(w *protoWriter) { w.anyValue(r.body) })
+	w.keyValues(6, r.attributes)
+	if r.flags != 0 {
+		w.fixed32(8, r.flags)
+	}
+	if r.traceID != nil {
+		w.bytes(9, r.traceID)
+	}
+	if r.spanID != nil {
+		w.bytes(10, r.spanID)
+	}
+	w.fixed64(11, r.observedTime)
+}
+
+//jsonAnyValue OTLP/JSON的AnyValue int64使用字符串 bytes使用base64
+func jsonAnyValue(v interface{}) map[string]interface{} {
+	switch t := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": t}
+	case bool:
+		return map[string]interface{}{"boolValue": t}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(t, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": t}
+	case []interface{}:
+		values := make([]interface{}, len(t))
+		for i, item := range t {
+			values[i] = jsonAnyValue(item)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case []otlpKV:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": jsonKeyValues(t)}}
+	case []byte:
+		return map[string]interface{}{"bytesValue": base64.StdEncoding.EncodeToString(t)}
+	}
+	return map[string]interface{}{}
+}
+
+func jsonKeyValues(kvs []otlpKV) []interface{} {
+	values := make([]interface{}, len(kvs))
+	for i, kv := range kvs {
+		values[i] = map[string]interface{}{"key": kv.key, "value": jsonAnyValue(kv.value)}
+	}
+	return values
+}
+
+//encodeJSON 按OTLP/JSON编码 traceId spanId为16进制字符串
+func (ot *otlpTarget) encodeJSON(records []*otlpRecord) []byte {
+	scopes, groups := groupByScope(records)
+	scopeLogs := make([]interface{}, 0, len(scopes))
+	for _, scope := range scopes {
+		logRecords := make([]interface{}, 0, len(groups[scope]))
+		for _, r := range groups[scope] {
+			record := map[string]interface{}{
+				"timeUnixNano":         strconv.FormatUint(r.time, 10),
+				"observedTimeUnixNano": strconv.FormatUint(r.observedTime, 10),
+				"severityNumber":       r.severity,
+				"severityText":         r.severityText,
+				"body":                 jsonAnyValue(r.body),
+				"attributes":           jsonKeyValues(r.attributes),
+			}
+			if r.flags != 0 {
+				record["flags"] = r.flags
+			}
+			if r.traceID != nil {
+				record["traceId"] = hex.EncodeToString(r.traceID)
+			}
+			if r.spanID != nil {
+				record["spanId"] = hex.EncodeToString(r.spanID)
+			}
+			logRecords = append(logRecords, record)
+		}
+		scopeLogs = append(scopeLogs, map[string]interface{}{
+			"scope":      map[string]interface{}{"name": scope},
+			"logRecords": logRecords,
+		})
+	}
+	request := map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource":  map[string]interface{}{"attributes": jsonKeyValues(ot.resource)},
+				"scopeLogs": scopeLogs,
+			},
+		},
+	}
+	bs, _ := json.Marshal(request)
+	return bs
+}
+
+func createOTLPTarget(config map[string]interface{}) Target {
+	if _, ok := config["URL"]; !ok {
+		//默认发送到本机Collector 不修改传入的配置
+		copied := make(map[string]interface{}, len(config)+1)
+		for k, v := range config {
+			copied[k] = v
+		}
+		copied["URL"] = "http://localhost:4318/v1/logs"
+		config = copied
+	}
+	sender, err := newHTTPSender(config)
+	if err != nil {
+		log.Println("createOTLPTarget:", err)
+		return nil
+	}
+	resource := make(map[string]interface{})
+	for k, v := range configMap(config, "Resource") {
+		if s, ok := v.(string); ok {
+			v = os.ExpandEnv(s)
+		}
+		resource[k] = v
+	}
+	ot := &otlpTarget{
+		targetFilter: newTargetFilter(config),
+		sender:       sender,
+		json:         configString(config, "Encoding", "protobuf") == "json",
+		resource:     otlpAttributes(resource),
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 512),
+		locker:       &sync.Mutex{},
+	}
+	ot.nextWriteTime = time.Now().Add(ot.interval)
+	return ot
+}
@@ -0,0 +1,254 @@
+package glog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+//protoFields 解码后的1层protobuf消息 varint和fixed字段为uint64 length-delimited字段为[]byte
+type protoFields map[int][]interface{}
+
+func decodeProto(t *testing.T, b []byte) protoFields {
+	t.Helper()
+	fields := protoFields{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad tag %x", b)
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint field %d", field)
+			}
+			b = b[n:]
+			fields[field] = append(fields[field], v)
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 field %d", field)
+			}
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				t.Fatalf("short bytes field %d", field)
+			}
+			fields[field] = append(fields[field], b[n:n+int(size)])
+			b = b[n+int(size):]
+		case 5:
+			if len(b) < 4 {
+				t.Fatalf("short fixed32 field %d", field)
+			}
+			fields[field] = append(fields[field], uint64(binary.LittleEndian.Uint32(b)))
+			b = b[4:]
+		default:
+			t.Fatalf("unsupported wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+func (f protoFields) message(t *testing.T, field int, i int) protoFields {
+	t.Helper()
+	if len(f[field]) <= i {
+		t.Fatalf("field %d has %d values", field, len(f[field]))
+	}
+	return decodeProto(t, f[field][i].([]byte))
+}
+
+func (f protoFields) string(field int) string {
+	if len(f[field]) == 0 {
+		return ""
+	}
+	return string(f[field][0].([]byte))
+}
+
+func (f protoFields) uint(field int) uint64 {
+	if len(f[field]) == 0 {
+		return 0
+	}
+	return f[field][0].(uint64)
+}
+
+//attributes 解码KeyValue列表 AnyValue只返回解码后的字段
+func (f protoFields) attributes(t *testing.T, field int) map[string]protoFields {
+	t.Helper()
+	attributes := make(map[string]protoFields)
+	for i := range f[field] {
+		kv := f.message(t, field, i)
+		attributes[kv.string(1)] = kv.message(t, 2, 0)
+	}
+	return attributes
+}
+
+func otlpTestEvents() []*LogEvent {
+	slow := testEvent(WarnLevel, "db", "slow query")
+	slow.Properties = Properties{
+		"rows":        3,
+		"ratio":       0.5,
+		"user":        map[string]interface{}{"id": "42"},
+		"trace_id":    "0102030405060708090a0b0c0d0e0f10",
+		"span_id":     "0102030405060708",
+		"trace_flags": "01",
+	}
+	return []*LogEvent{
+		slow,
+		testEvent(InfoLevel, "http", "GET /"),
+		testEvent(ErrorLevel, "db", "failed"),
+	}
+}
+
+func TestOTLPTargetProtobuf(t *testing.T) {
+	c := &collector{}
+	target := createOTLPTarget(map[string]interface{}{
+		"URL":      newCollector(t, c),
+		"Resource": map[string]interface{}{"service.name": "billing"},
+	}).(*otlpTarget)
+	defer target.Close()
+	for _, e := range otlpTestEvents() {
+		target.TryWrite(e, nil)
+	}
+	if err := target.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	requests := c.received()
+	if len(requests) != 1 || requests[0].contentType != "application/x-protobuf" {
+		t.Fatalf("got %+v", requests)
+	}
+
+	request := decodeProto(t, []byte(requests[0].body))
+	resourceLogs := request.message(t, 1, 0)
+	resource := resourceLogs.message(t, 1, 0).attributes(t, 1)
+	if resource["service.name"].string(1) != "billing" {
+		t.Fatalf("resource = %v", resource)
+	}
+	//按logger的Name分组 保持第1次出现的顺序
+	if n := len(resourceLogs[2]); n != 2 {
+		t.Fatalf("got %d ScopeLogs", n)
+	}
+	db, http := resourceLogs.message(t, 2, 0), resourceLogs.message(t, 2, 1)
+	if db.message(t, 1, 0).string(1) != "db" || http.message(t, 1, 0).string(1) != "http" {
+		t.Fatal("wrong scope names")
+	}
+	if len(db[2]) != 2 || len(http[2]) != 1 {
+		t.Fatalf("got %d db and %d http records", len(db[2]), len(http[2]))
+	}
+
+	record := db.message(t, 2, 0)
+	ts := time.Date(2024, 3, 5, 7, 8, 9, 123456000, time.UTC)
+	if record.uint(1) != uint64(ts.UnixNano()) {
+		t.Fatalf("time = %d", record.uint(1))
+	}
+	if record.uint(2) != 13 || record.string(3) != levelName(WarnLevel) {
+		t.Fatalf("severity = %d %s", record.uint(2), record.string(3))
+	}
+	if body := record.message(t, 5, 0).string(1); body != "slow query" {
+		t.Fatalf("body = %q", body)
+	}
+	attributes := record.attributes(t, 6)
+	if len(attributes) != 3 {
+		t.Fatalf("attributes = %v", attributes)
+	}
+	if attributes["rows"].uint(3) != 3 {
+		t.Fatalf("rows = %v", attributes["rows"])
+	}
+	if math.Float64frombits(attributes["ratio"].uint(4)) != 0.5 {
+		t.Fatalf("ratio = %v", attributes["ratio"])
+	}
+	user := attributes["user"].message(t, 6, 0).attributes(t, 1)
+	if user["id"].string(1) != "42" {
+		t.Fatalf("user = %v", user)
+	}
+	if record.uint(8) != 1 || len(record.string(9)) != 16 || len(record.string(10)) != 8 {
+		t.Fatalf("trace = %d %x %x", record.uint(8), record.string(9), record.string(10))
+	}
+	if record.uint(11) == 0 {
+		t.Fatal("missing observed time")
+	}
+	if stats := target.TargetStats(); stats.BytesWritten != uint64(len(requests[0].body)) {
+		t.Fatalf("BytesWritten = %d", stats.BytesWritten)
+	}
+}
+
+func TestOTLPTargetJSON(t *testing.T) {
+	c := &collector{}
+	target := createOTLPTarget(map[string]interface{}{
+		"URL":      newCollector(t, c),
+		"Encoding": "json",
+	}).(*otlpTarget)
+	defer target.Close()
+	for _, e := range otlpTestEvents() {
+		target.TryWrite(e, nil)
+	}
+	if err := target.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	requests := c.received()
+	if len(requests) != 1 || requests[0].contentType != "application/json" {
+		t.Fatalf("got %+v", requests)
+	}
+	var request struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				Scope      struct{ Name string }
+				LogRecords []struct {
+					TimeUnixNano   string
+					SeverityNumber int
+					Body           struct{ StringValue string }
+					TraceID        string `json:"traceId"`
+					SpanID         string `json:"spanId"`
+					Flags          int
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(requests[0].body), &request); err != nil {
+		t.Fatal(err)
+	}
+	scopes := request.ResourceLogs[0].ScopeLogs
+	if len(scopes) != 2 || scopes[0].Scope.Name != "db" || len(scopes[0].LogRecords) != 2 {
+		t.Fatalf("got %+v", scopes)
+	}
+	record := scopes[0].LogRecords[0]
+	if record.TimeUnixNano != "1709622489123456000" || record.SeverityNumber != 13 ||
+		record.Body.StringValue != "slow query" || record.TraceID != "0102030405060708090a0b0c0d0e0f10" ||
+		record.SpanID != "0102030405060708" || record.Flags != 1 {
+		t.Fatalf("got %+v", record)
+	}
+}
+
+func TestOTLPTargetRetryAfter(t *testing.T) {
+	c := &collector{statuses: []int{429}, retryAfter: "3600"}
+	target := createOTLPTarget(map[string]interface{}{
+		"URL":      newCollector(t, c),
+		"RetryMin": "10ms",
+		"RetryMax": "50ms",
+	}).(*otlpTarget)
+	defer target.Close()
+	target.TryWrite(testEvent(InfoLevel, "app", "first"), nil)
+	if err := target.Sync(); err == nil {
+		t.Fatal("Sync should return the 429")
+	}
+	//Retry-After超过RetryMax时按RetryMax重试
+	deadline := time.Now().Add(time.Second)
+	for target.Sync() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("not retried within RetryMax")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	requests := c.received()
+	if len(requests) != 2 || requests[0].body != requests[1].body {
+		t.Fatalf("got %d requests", len(requests))
+	}
+	if stats := target.TargetStats(); stats.Dropped != 0 {
+		t.Fatalf("Dropped = %d", stats.Dropped)
+	}
+}
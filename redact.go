@@ -0,0 +1,318 @@
+package glog
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+//Redactable 类型可以实现该接口 返回可以安全写入日志的内容 用于参数以及Properties的值
+type Redactable interface {
+	Redact() interface{}
+}
+
+//RedactOptions 脱敏配置
+type RedactOptions struct {
+	Keys     []string //Properties的key 不区分大小写 支持通配符 如password *token*
+	Patterns []string //消息中需要替换的正则 内置creditcard jwt bearer email
+	Mask     string   //替换后的内容 默认***
+}
+
+//redactPattern 消息中需要替换的内容 replace为nil时整个替换成mask
+type redactPattern struct {
+	re      *regexp.Regexp
+	replace func(match string, mask string) string
+}
+
+//内置的脱敏规则
+var builtinRedactPatterns = map[string]*redactPattern{
+	"creditcard": {
+		re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		replace: func(match string, mask string) string {
+			if !luhnValid(match) {
+				return match
+			}
+			return mask
+		},
+	},
+	"jwt": {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"bearer": {
+		re: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		replace: func(match string, mask string) string {
+			i := strings.IndexAny(match, " \t")
+			return match[:i+1] + mask
+		},
+	},
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+}
+
+//luhnValid 卡号校验 减少把普通数字当成卡号
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+//redactedError 替换掉敏感内容的错误
+type redactedError string
+
+func (e redactedError) Error() string {
+	return string(e)
+}
+
+//Redactor 在序列化之前替换LogEvent中的敏感内容 可以同时在多个routine中使用
+type Redactor struct {
+	keys     []string
+	patterns []*redactPattern
+	mask     string
+}
+
+//NewRedactor 编译脱敏配置 可以设置到Layout.Redactor
+func NewRedactor(opts RedactOptions) (*Redactor, error) {
+	r := &Redactor{mask: opts.Mask}
+	if r.mask == "" {
+		r.mask = "***"
+	}
+	for _, k := range opts.Keys {
+		k = strings.ToLower(k)
+		if _, err := path.Match(k, ""); err != nil {
+			return nil, fmt.Errorf("redact key %q: %w", k, err)
+		}
+		r.keys = append(r.keys, k)
+	}
+	for _, p := range opts.Patterns {
+		if v, ok := builtinRedactPatterns[p]; ok {
+			r.patterns = append(r.patterns, v)
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, &redactPattern{re: re})
+	}
+	return r, nil
+}
+
+//Redact 返回脱敏后的副本 不修改e
+func (r *Redactor) Redact(e *LogEvent) *LogEvent {
+	copied := *e
+	args, changed := redactArgs(e.Args)
+	if changed {
+		copied.Args = args
+	}
+	if len(r.patterns) > 0 {
+		msg := copied.Message()
+		if masked := r.maskText(msg); masked != msg {
+			copied.Format = ""
+			copied.Args = []interface{}{masked}
+		}
+		if e.Err != nil {
+			msg := e.Err.Error()
+			if masked := r.maskText(msg); masked != msg {
+				copied.Err = redactedError(masked)
+			}
+		}
+	}
+	if e.Properties != nil {
+		copied.Properties = r.redactMap(e.Properties)
+	}
+	return &copied
+}
+
+//redactArgs 替换实现了Redactable的参数
+func redactArgs(args []interface{}) ([]interface{}, bool) {
+	var result []interface{}
+	for i, v := range args {
+		rv, ok := v.(Redactable)
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = append([]interface{}(nil), args...)
+		}
+		result[i] = rv.Redact()
+	}
+	return result, result != nil
+}
+
+//maxRedactDepth 递归的最大层数 避免循环引用
+const maxRedactDepth = 16
+
+func (r *Redactor) redactMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if r.matchKey(k) {
+			result[k] = r.mask
+		} else {
+			result[k], _ = r.redactValue(v, 1)
+		}
+	}
+	return result
+}
+
+//redactValue 递归替换map struct slice中的敏感内容 没有改变时返回v本身
+//有改变时map和struct转换为map[string]interface{} struct使用json tag作为key slice转换为[]interface{}
+func (r *Redactor) redactValue(v interface{}, depth int) (interface{}, bool) {
+	switch t := v.(type) {
+	case nil:
+		return v, false
+	case Redactable:
+		return t.Redact(), true
+	case string:
+		masked := r.maskText(t)
+		return masked, masked != t
+	case []byte:
+		return v, false
+	}
+	if depth > maxRedactDepth {
+		return v, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return v, false
+		}
+		if elem, changed := r.redactValue(rv.Elem().Interface(), depth+1); changed {
+			return elem, true
+		}
+	case reflect.Map:
+		return r.redactReflectMap(rv, depth)
+	case reflect.Struct:
+		return r.redactStruct(rv, depth)
+	case reflect.Slice, reflect.Array:
+		return r.redactSlice(rv, depth)
+	}
+	return v, false
+}
+
+func (r *Redactor) redactReflectMap(rv reflect.Value, depth int) (interface{}, bool) {
+	result := make(map[string]interface{}, rv.Len())
+	changed := false
+	iter := rv.MapRange()
+	for iter.Next() {
+		k := fmt.Sprint(iter.Key().Interface())
+		if r.matchKey(k) {
+			result[k] = r.mask
+			changed = true
+			continue
+		}
+		value, ok := r.redactValue(iter.Value().Interface(), depth+1)
+		result[k] = value
+		changed = changed || ok
+	}
+	if !changed {
+		return rv.Interface(), false
+	}
+	return result, true
+}
+
+//redactStruct 只处理导出的字段 忽略json:"-"
+func (r *Redactor) redactStruct(rv reflect.Value, depth int) (interface{}, bool) {
+	rt := rv.Type()
+	result := make(map[string]interface{}, rt.NumField())
+	changed := false
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if r.matchKey(name) {
+			result[name] = r.mask
+			changed = true
+			continue
+		}
+		value, ok := r.redactValue(rv.Field(i).Interface(), depth+1)
+		result[name] = value
+		changed = changed || ok
+	}
+	if !changed {
+		return rv.Interface(), false
+	}
+	return result, true
+}
+
+func (r *Redactor) redactSlice(rv reflect.Value, depth int) (interface{}, bool) {
+	result := make([]interface{}, rv.Len())
+	changed := false
+	for i := range result {
+		value, ok := r.redactValue(rv.Index(i).Interface(), depth+1)
+		result[i] = value
+		changed = changed || ok
+	}
+	if !changed {
+		return rv.Interface(), false
+	}
+	return result, true
+}
+
+func (r *Redactor) matchKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range r.keys {
+		if ok, _ := path.Match(k, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) maskText(s string) string {
+	for _, p := range r.patterns {
+		if p.replace == nil {
+			s = p.re.ReplaceAllLiteralString(s, r.mask)
+			continue
+		}
+		s = p.re.ReplaceAllStringFunc(s, func(match string) string {
+			return p.replace(match, r.mask)
+		})
+	}
+	return s
+}
+
+//parseRedactor 解析Layout中的Redact配置
+func parseRedactor(config map[string]interface{}) (*Redactor, error) {
+	if config == nil {
+		return nil, nil
+	}
+	opts := RedactOptions{Mask: configString(config, "Mask", "")}
+	keys, _ := config["Keys"].([]interface{})
+	for _, v := range keys {
+		if s, ok := v.(string); ok {
+			opts.Keys = append(opts.Keys, s)
+		}
+	}
+	patterns, _ := config["Patterns"].([]interface{})
+	for _, v := range patterns {
+		if s, ok := v.(string); ok {
+			opts.Patterns = append(opts.Patterns, s)
+		}
+	}
+	return NewRedactor(opts)
+}
@@ -0,0 +1,103 @@
+package glog
+
+import (
+	"reflect"
+	"testing"
+)
+
+type redactCredentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Token    string `json:"-"`
+	secret   string
+}
+
+type redactRequest struct {
+	Path    string
+	Auth    *redactCredentials
+	Headers map[string]string
+}
+
+func TestRedactNested(t *testing.T) {
+	r, err := NewRedactor(RedactOptions{Keys: []string{"password", "authorization"}, Patterns: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged := redactRequest{Path: "/health"}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{
+			name:  "nested map",
+			value: map[string]interface{}{"db": map[string]interface{}{"password": "p"}},
+			want:  map[string]interface{}{"db": map[string]interface{}{"password": "***"}},
+		},
+		{
+			name:  "nested Properties",
+			value: Properties{"db": Properties{"Password": "p", "host": "h"}},
+			want:  map[string]interface{}{"db": map[string]interface{}{"Password": "***", "host": "h"}},
+		},
+		{
+			name:  "map[string]string",
+			value: map[string]string{"Authorization": "Bearer x", "mail": "a@b.com"},
+			want:  map[string]interface{}{"Authorization": "***", "mail": "***"},
+		},
+		{
+			name:  "struct pointer with json tags",
+			value: &redactCredentials{User: "a@b.com", Password: "p", Token: "t", secret: "s"},
+			want:  map[string]interface{}{"user": "***", "password": "***"},
+		},
+		{
+			name: "struct with nested struct and map",
+			value: redactRequest{
+				Path:    "/login",
+				Auth:    &redactCredentials{User: "bob", Password: "p"},
+				Headers: map[string]string{"authorization": "x"},
+			},
+			want: map[string]interface{}{
+				"Path":    "/login",
+				"Auth":    map[string]interface{}{"user": "bob", "password": "***"},
+				"Headers": map[string]interface{}{"authorization": "***"},
+			},
+		},
+		{
+			name:  "slice of maps",
+			value: []map[string]interface{}{{"password": "p"}, {"name": "n"}},
+			want:  []interface{}{map[string]interface{}{"password": "***"}, map[string]interface{}{"name": "n"}},
+		},
+		{
+			name:  "array of strings",
+			value: [2]string{"a@b.com", "plain"},
+			want:  []interface{}{"***", "plain"},
+		},
+		{
+			name:  "unchanged struct",
+			value: unchanged,
+			want:  unchanged,
+		},
+		{
+			name:  "unchanged slice",
+			value: []int{1, 2},
+			want:  []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &LogEvent{Properties: Properties{"value": tt.value}}
+			got := r.Redact(e).Properties["value"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactCycle(t *testing.T) {
+	r, _ := NewRedactor(RedactOptions{Keys: []string{"password"}})
+	cycle := map[string]interface{}{}
+	cycle["self"] = cycle
+	//超过最大层数后不再递归
+	r.Redact(&LogEvent{Properties: Properties{"value": cycle}})
+}
@@ -0,0 +1,180 @@
+package glog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//maxSampleKeys 1个采样周期内最多跟踪的key数量 超过后新的key只受限速控制
+const maxSampleKeys = 10000
+
+//SamplerOptions 采样和限速配置
+//采样以级别+logger的Name+Format为key 每个Interval内前First条全部写入 之后每Thereafter条写入1条
+//Rate大于0时使用令牌桶限速 每秒Rate条 最多突发Burst条
+type SamplerOptions struct {
+	Interval        time.Duration //采样周期 默认1s
+	First           int           //为0时不采样
+	Thereafter      int           //为0时超过First后全部丢弃
+	Rate            float64       //为0时不限速
+	Burst           int           //默认等于Rate
+	SummaryInterval time.Duration //输出"suppressed N similar messages"的间隔 默认10s
+}
+
+//sampleState 1个key的采样状态
+type sampleState struct {
+	level      LogLevel
+	name       string
+	format     string
+	count      int //当前周期内的条数
+	suppressed int //上次输出汇总后丢弃的条数
+}
+
+//Sampler 按SamplerOptions丢弃重复的日志 可以同时在多个routine中使用
+type Sampler struct {
+	opts SamplerOptions
+
+	locker      sync.Mutex
+	states      map[string]*sampleState //protected by locker
+	windowEnd   time.Time               //protected by locker
+	tokens      float64                 //protected by locker
+	lastRefill  time.Time               //protected by locker
+	nextSummary time.Time               //protected by locker
+}
+
+//NewSampler 创建Sampler 可以设置到Layout.Sampler或者LoggerConfig.Sampler
+func NewSampler(opts SamplerOptions) *Sampler {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = int(opts.Rate)
+		if opts.Burst < 1 {
+			opts.Burst = 1
+		}
+	}
+	if opts.SummaryInterval <= 0 {
+		opts.SummaryInterval = 10 * time.Second
+	}
+	now := time.Now()
+	return &Sampler{
+		opts:        opts,
+		states:      make(map[string]*sampleState),
+		windowEnd:   now.Add(opts.Interval),
+		tokens:      float64(opts.Burst),
+		lastRefill:  now,
+		nextSummary: now.Add(opts.SummaryInterval),
+	}
+}
+
+//Allow 是否写入这条日志 Panic和Fatal总是写入
+func (s *Sampler) Allow(e *LogEvent) bool {
+	if e.Level >= PanicLevel {
+		return true
+	}
+	format := e.Format
+	if format == "" {
+		format = e.Message()
+	}
+	key := fmt.Sprintf("%d\x00%s\x00%s", e.Level, e.Name, format)
+	now := time.Now()
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if now.After(s.windowEnd) {
+		for k, v := range s.states {
+			if v.suppressed == 0 {
+				delete(s.states, k)
+			} else {
+				v.count = 0
+			}
+		}
+		s.windowEnd = now.Add(s.opts.Interval)
+	}
+	st := s.states[key]
+	if st == nil && len(s.states) < maxSampleKeys {
+		st = &sampleState{level: e.Level, name: e.Name, format: format}
+		s.states[key] = st
+	}
+	allowed := true
+	if st != nil {
+		st.count++
+		if s.opts.First > 0 && st.count > s.opts.First {
+			allowed = s.opts.Thereafter > 0 && (st.count-s.opts.First)%s.opts.Thereafter == 0
+		}
+	}
+	if allowed && s.opts.Rate > 0 {
+		s.tokens += now.Sub(s.lastRefill).Seconds() * s.opts.Rate
+		if s.tokens > float64(s.opts.Burst) {
+			s.tokens = float64(s.opts.Burst)
+		}
+		s.lastRefill = now
+		if s.tokens < 1 {
+			allowed = false
+		} else {
+			s.tokens--
+		}
+	}
+	if !allowed && st != nil {
+		st.suppressed++
+	}
+	return allowed
+}
+
+//summary 到达SummaryInterval或者force时 为每个有丢弃的key生成1条汇总日志
+func (s *Sampler) summary(force bool) []*LogEvent {
+	now := time.Now()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !force && now.Before(s.nextSummary) {
+		return nil
+	}
+	s.nextSummary = now.Add(s.opts.SummaryInterval)
+	var events []*LogEvent
+	for _, v := range s.states {
+		if v.suppressed == 0 {
+			continue
+		}
+		events = append(events, &LogEvent{
+			Properties: map[string]interface{}{"suppressed": v.suppressed},
+			Level:      v.level,
+			LevelDesc:  levelName(v.level),
+			Name:       v.name,
+			Format:     "suppressed %d similar messages: %s",
+			Args:       []interface{}{v.suppressed, v.format},
+			Time:       now.Format("2006-01-02 15:04:05.0000"),
+			Timestamp:  now,
+		})
+		v.suppressed = 0
+	}
+	return events
+}
+
+//LoggerConfig 按logger名称的配置 LogConfig.Loggers中"*"对应所有没有单独配置的logger
+type LoggerConfig struct {
+	Sampler *Sampler //为nil时不采样
+	Dedup   *Deduper //为nil时不合并重复的日志
+}
+
+//parseDeduper 解析Loggers中的Dedup配置
+func parseDeduper(config map[string]interface{}) *Deduper {
+	if config == nil {
+		return nil
+	}
+	return NewDeduper(configDuration(config, "Window", time.Second))
+}
+
+//parseSampler 解析Layout或者Loggers中的Sampling配置
+func parseSampler(config map[string]interface{}) *Sampler {
+	if config == nil {
+		return nil
+	}
+	return NewSampler(SamplerOptions{
+		Interval:        configDuration(config, "Interval", time.Second),
+		First:           configInt(config, "First", 0),
+		Thereafter:      configInt(config, "Thereafter", 0),
+		Rate:            configFloat(config, "Rate", 0),
+		Burst:           configInt(config, "Burst", 0),
+		SummaryInterval: configDuration(config, "SummaryInterval", 10*time.Second),
+	})
+}
@@ -0,0 +1,40 @@
+package glog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoggerSamplerSummary(t *testing.T) {
+	var buf bytes.Buffer
+	config := NewLogConfig()
+	config.Loggers = map[string]*LoggerConfig{
+		"*": {Sampler: NewSampler(SamplerOptions{First: 1})},
+	}
+	config.Layouts = []*Layout{{
+		Target:     NewWriterTarget(&buf, WriterOptions{}),
+		Serializer: messageSerializer{},
+		//只允许2条 logger的汇总不应该被它丢弃
+		Sampler: NewSampler(SamplerOptions{Rate: 0.001, Burst: 2}),
+	}}
+	m := NewWithConfig(config)
+	for i := 0; i < 3; i++ {
+		m.GetLogger("a").Info("hello")
+		m.GetLogger("b").Info("hello")
+	}
+	m.Close(context.Background())
+
+	//不同logger相同的消息分别计数
+	want := []string{
+		"hello",
+		"hello",
+		"suppressed 2 similar messages: hello",
+		"suppressed 2 similar messages: hello",
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 )
 
 //Serializer 序列化接口
@@ -27,10 +28,16 @@ func (ds *DefaultSerializer) Encode(e *LogEvent) []byte {
 	buf.WriteString("@Name:")
 	buf.WriteString(e.Name)
 	buf.WriteString("@Message:")
-	if e.Format != "" {
-		buf.WriteString(fmt.Sprintf(e.Format, e.Args...))
-	} else {
-		buf.WriteString(fmt.Sprint(e.Args...))
+	buf.WriteString(e.Message())
+	if e.Err != nil {
+		buf.WriteString("@Error:")
+		buf.WriteString(e.Err.Error())
+		buf.WriteString("@ErrorType:")
+		buf.WriteString(errorType(e.Err))
+	}
+	if e.Caller != nil {
+		buf.WriteString("@Caller:")
+		buf.WriteString(e.Caller.String())
 	}
 	if e.StackTrace != "" {
 		buf.WriteString("@StackTrace:")
@@ -45,11 +52,17 @@ func (ds *DefaultSerializer) Encode(e *LogEvent) []byte {
 }
 
 //JSONSerializer json序列化接口
+//Style为"otel"时使用OpenTelemetry日志数据模型的字段名 Properties中的trace_id span_id trace_flags
+//输出为TraceId SpanId TraceFlags 其他Properties以及错误 调用者输出到Attributes
 type JSONSerializer struct {
+	Style string
 }
 
 //Encode 实现Serialization
 func (js *JSONSerializer) Encode(e *LogEvent) []byte {
+	if js.Style == "otel" {
+		return encodeOTelJSON(e)
+	}
 	properties := make(map[string]interface{})
 	if e.Properties != nil {
 		for k, v := range e.Properties {
@@ -58,10 +71,12 @@ func (js *JSONSerializer) Encode(e *LogEvent) []byte {
 	}
 	properties["Level"] = e.LevelDesc
 	properties["Name"] = e.Name
-	if e.Format != "" {
-		properties["Message"] = fmt.Sprintf(e.Format, e.Args...)
-	} else {
-		properties["Message"] = fmt.Sprint(e.Args...)
+	properties["Message"] = e.Message()
+	if e.Err != nil {
+		properties["error"] = NewErrorInfo(e.Err)
+	}
+	if e.Caller != nil {
+		properties["Caller"] = e.Caller
 	}
 	if e.StackTrace != "" {
 		properties["StackTrace"] = e.StackTrace
@@ -74,3 +89,95 @@ func (js *JSONSerializer) Encode(e *LogEvent) []byte {
 	}
 	return bs
 }
+
+//otelSeverity LogLevel对应的OpenTelemetry SeverityNumber
+func otelSeverity(l LogLevel) int {
+	switch l {
+	case TraceLevel:
+		return 1
+	case DebugLevel:
+		return 5
+	case InfoLevel:
+		return 9
+	case WarnLevel:
+		return 13
+	case ErrorLevel:
+		return 17
+	case PanicLevel:
+		return 21
+	case FatalLevel:
+		return 22
+	}
+	return 0
+}
+
+//otelAttributes Properties 错误以及调用者按OpenTelemetry语义约定生成Attributes 不包括trace字段
+func otelAttributes(e *LogEvent) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(e.Properties)+6)
+	for k, v := range e.Properties {
+		switch k {
+		case "trace_id", "span_id", "trace_flags":
+		default:
+			attributes[k] = v
+		}
+	}
+	if e.Err != nil {
+		attributes["exception.message"] = e.Err.Error()
+		attributes["exception.type"] = errorType(e.Err)
+	}
+	if e.StackTrace != "" {
+		attributes["exception.stacktrace"] = e.StackTrace
+	}
+	if e.Caller != nil {
+		attributes["code.filepath"] = e.Caller.File
+		attributes["code.lineno"] = e.Caller.Line
+		attributes["code.function"] = e.Caller.Function
+	}
+	return attributes
+}
+
+//otelTraceFlags trace_flags为2位16进制字符串 如"01"
+func otelTraceFlags(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case string:
+		n, err := strconv.ParseUint(t, 16, 8)
+		return int(n), err == nil
+	case int:
+		return t, true
+	case uint8:
+		return int(t), true
+	}
+	return 0, false
+}
+
+func encodeOTelJSON(e *LogEvent) []byte {
+	desc := e.LevelDesc
+	if desc == "" {
+		desc = levelName(e.Level)
+	}
+	record := map[string]interface{}{
+		"Timestamp":      eventTime(e).UnixNano(),
+		"SeverityText":   desc,
+		"SeverityNumber": otelSeverity(e.Level),
+		"Body":           e.Message(),
+		"Attributes":     otelAttributes(e),
+	}
+	if e.Name != "" {
+		record["InstrumentationScope"] = map[string]interface{}{"Name": e.Name}
+	}
+	if v, ok := e.Properties["trace_id"]; ok {
+		record["TraceId"] = v
+	}
+	if v, ok := e.Properties["span_id"]; ok {
+		record["SpanId"] = v
+	}
+	if flags, ok := otelTraceFlags(e.Properties["trace_flags"]); ok {
+		record["TraceFlags"] = flags
+	}
+	bs, err := json.Marshal(record)
+	if err != nil {
+		fmt.Println("JSONSerialization:", err)
+		return nil
+	}
+	return bs
+}
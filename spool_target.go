@@ -0,0 +1,646 @@
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//spoolRecord 磁盘中的1条日志 格式为
+//4字节大端长度(不包括自身) 1字节级别 8字节时间(UnixNano) 2字节Name长度 Name 4字节meta长度 meta 序列化后的日志
+//meta为spoolEvent的json 重放时用来还原LogEvent
+type spoolRecord struct {
+	event   *LogEvent
+	payload []byte
+}
+
+//spoolEvent LogEvent中需要保存到磁盘的部分 Args保存为格式化后的消息 Context无法保存
+type spoolEvent struct {
+	LevelDesc  string                     `json:"level_desc,omitempty"`
+	Message    string                     `json:"message,omitempty"`
+	Properties map[string]json.RawMessage `json:"properties,omitempty"`
+	Err        *ErrorInfo                 `json:"error,omitempty"`
+	Caller     *Caller                    `json:"caller,omitempty"`
+	StackTrace string                     `json:"stack_trace,omitempty"`
+	Time       string                     `json:"time,omitempty"`
+}
+
+func encodeSpoolRecord(event *LogEvent, payload []byte) []byte {
+	name := event.Name
+	if len(name) > 0xffff {
+		name = name[:0xffff]
+	}
+	meta := encodeSpoolEvent(event)
+	size := 1 + 8 + 2 + len(name) + 4 + len(meta) + len(payload)
+	record := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(record, uint32(size))
+	record[4] = byte(event.Level)
+	binary.BigEndian.PutUint64(record[5:], uint64(eventTime(event).UnixNano()))
+	binary.BigEndian.PutUint16(record[13:], uint16(len(name)))
+	copy(record[15:], name)
+	offset := 15 + len(name)
+	binary.BigEndian.PutUint32(record[offset:], uint32(len(meta)))
+	copy(record[offset+4:], meta)
+	copy(record[offset+4+len(meta):], payload)
+	return record
+}
+
+//encodeSpoolEvent 无法编码为json的属性保存为fmt.Sprint的结果
+func encodeSpoolEvent(e *LogEvent) []byte {
+	se := &spoolEvent{
+		LevelDesc:  e.LevelDesc,
+		Message:    e.Message(),
+		Err:        NewErrorInfo(e.Err),
+		Caller:     e.Caller,
+		StackTrace: e.StackTrace,
+		Time:       e.Time,
+	}
+	if len(e.Properties) > 0 {
+		se.Properties = make(map[string]json.RawMessage, len(e.Properties))
+		for k, v := range e.Properties {
+			if err, ok := v.(error); ok && !isNilError(err) {
+				v = err.Error()
+			}
+			bs, err := json.Marshal(v)
+			if err != nil {
+				bs, _ = json.Marshal(fmt.Sprint(v))
+			}
+			se.Properties[k] = bs
+		}
+	}
+	bs, _ := json.Marshal(se)
+	return bs
+}
+
+//decodeSpoolEvent 还原LogEvent meta无法解析时只有Level Name和时间
+func decodeSpoolEvent(level LogLevel, t time.Time, name string, meta []byte) *LogEvent {
+	event := &LogEvent{
+		Level:     level,
+		LevelDesc: levelName(level),
+		Name:      name,
+		Time:      t.Format("2006-01-02 15:04:05.0000"),
+		Timestamp: t,
+	}
+	se := &spoolEvent{}
+	if err := json.Unmarshal(meta, se); err != nil {
+		return event
+	}
+	if se.LevelDesc != "" {
+		event.LevelDesc = se.LevelDesc
+	}
+	if se.Time != "" {
+		event.Time = se.Time
+	}
+	if se.Message != "" {
+		event.Args = []interface{}{se.Message}
+	}
+	if len(se.Properties) > 0 {
+		event.Properties = make(Properties, len(se.Properties))
+		for k, raw := range se.Properties {
+			event.Properties[k] = decodeSpoolValue(raw)
+		}
+	}
+	if se.Err != nil {
+		event.Err = se.Err
+	}
+	event.Caller = se.Caller
+	event.StackTrace = se.StackTrace
+	return event
+}
+
+//decodeSpoolValue 整数还原为int64 其他数字为float64
+func decodeSpoolValue(raw json.RawMessage) interface{} {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return string(raw)
+	}
+	return normalizeSpoolValue(v)
+}
+
+func normalizeSpoolValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = normalizeSpoolValue(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = normalizeSpoolValue(item)
+		}
+	}
+	return v
+}
+
+//readSpoolRecord 返回记录以及占用的字节数 数据不完整时返回io.ErrUnexpectedEOF
+func readSpoolRecord(r io.Reader) (*spoolRecord, int64, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 15 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	nameLen := int(binary.BigEndian.Uint16(body[9:]))
+	if 15+nameLen > len(body) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	offset := 11 + nameLen
+	metaLen := int(binary.BigEndian.Uint32(body[offset:]))
+	if metaLen > len(body)-offset-4 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	meta := body[offset+4 : offset+4+metaLen]
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(body[1:])))
+	return &spoolRecord{
+		event:   decodeSpoolEvent(LogLevel(body[0]), t, string(body[11:offset]), meta),
+		payload: body[offset+4+metaLen:],
+	}, int64(4 + size), nil
+}
+
+//rawSerializer 重放时直接返回磁盘中保存的序列化结果 不使用Serializer的Target(如otlp)读取还原的LogEvent
+type rawSerializer []byte
+
+func (rs rawSerializer) Encode(e *LogEvent) []byte {
+	return rs
+}
+
+//errSpoolClosed Close之后写入时返回
+var errSpoolClosed = errors.New("spool closed")
+
+//spoolWAL 1个Dir中分段的预写日志
+//重新加载配置时新旧spoolTarget使用同一个spoolWAL 最后1个使用者Close时才关闭当前分段
+type spoolWAL struct {
+	dir  string
+	refs int //protected by spoolWALsLocker
+
+	locker       sync.Mutex
+	segment      *os.File //protected by locker 当前写入的分段
+	segmentStart int64    //protected by locker 当前分段的起始位置
+	writeOffset  int64    //protected by locker 所有分段中的写入位置
+	unsynced     int      //protected by locker
+	closed       bool     //protected by locker
+
+	ackLocker sync.Mutex //新旧spoolTarget的Sync可能同时调用
+	ackOffset int64      //protected by ackLocker 已经确认的位置
+	dropped   uint64     //atomic
+}
+
+var (
+	spoolWALsLocker sync.Mutex
+	spoolWALs       = make(map[string]*spoolWAL)
+)
+
+//openSpoolWAL 返回dir对应的spoolWAL 已经打开时增加引用计数
+func openSpoolWAL(dir string) (*spoolWAL, error) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	spoolWALsLocker.Lock()
+	defer spoolWALsLocker.Unlock()
+	if w, ok := spoolWALs[dir]; ok {
+		w.refs++
+		return w, nil
+	}
+	w := &spoolWAL{dir: dir, refs: 1}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	spoolWALs[dir] = w
+	return w, nil
+}
+
+//release 减少引用计数 为0时关闭当前分段
+func (w *spoolWAL) release() error {
+	spoolWALsLocker.Lock()
+	defer spoolWALsLocker.Unlock()
+	w.refs--
+	if w.refs > 0 {
+		return nil
+	}
+	delete(spoolWALs, w.dir)
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	w.closed = true
+	if w.segment == nil {
+		return nil
+	}
+	err := w.segment.Close()
+	w.segment = nil
+	return err
+}
+
+//append 写入当前分段 超过segmentSize时创建新的分段
+func (w *spoolWAL) append(record []byte, segmentSize int64) error {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	if w.closed {
+		return errSpoolClosed
+	}
+	if w.segment == nil || w.writeOffset-w.segmentStart >= segmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.segment.Write(record)
+	if err != nil {
+		//写入不完整时截断 避免后面的记录无法读取
+		w.segment.Truncate(w.writeOffset - w.segmentStart)
+		return err
+	}
+	w.writeOffset += int64(n)
+	w.unsynced += n
+	return nil
+}
+
+//rotate 创建以writeOffset命名的新分段 protected by locker
+func (w *spoolWAL) rotate() error {
+	if w.segment != nil {
+		w.segment.Sync()
+		w.segment.Close()
+		w.segment = nil
+	}
+	f, err := os.OpenFile(w.segmentPath(w.writeOffset), os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	w.segment = f
+	w.segmentStart = w.writeOffset
+	return nil
+}
+
+func (w *spoolWAL) unsyncedSize() int {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	return w.unsynced
+}
+
+//sync 把当前分段同步到磁盘 返回写入位置
+func (w *spoolWAL) sync() (int64, error) {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+	if w.closed {
+		return 0, errSpoolClosed
+	}
+	w.unsynced = 0
+	if w.segment != nil {
+		if err := w.segment.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return w.writeOffset, nil
+}
+
+//spoolTarget 先把序列化后的日志写入磁盘中分段的预写日志 再交给包装的Target
+//包装的Target Sync成功后才确认 重启后重放没有确认的日志 保证至少写入1次
+//包装的Target失败时从确认的位置重新交给它 实现了Retainer时先丢弃它自己保留的日志
+//磁盘使用超过MaxBytes时删除最早的分段 其中没有确认的日志会丢弃
+type spoolTarget struct {
+	targetFilter
+	child       Target
+	wal         *spoolWAL
+	segmentSize int64
+	maxBytes    int64
+	interval    time.Duration //只读 写入的时间间隔
+	cacheSize   int           //没有同步到磁盘的字节数超过该值时写入
+	batchSize   int           //每次交给child的最多条数
+
+	nextWriteTime time.Time
+	closed        int32 //atomic
+}
+
+func (st *spoolTarget) Write(event *LogEvent, sr Serializer) {
+	st.TryWrite(event, sr)
+}
+
+//TryWrite 写入当前分段 Sync时才调用fsync
+func (st *spoolTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	if atomic.LoadInt32(&st.closed) != 0 {
+		return errSpoolClosed
+	}
+	bs := sr.Encode(event)
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	return st.wal.append(encodeSpoolRecord(event, bs), st.segmentSize)
+}
+
+func (st *spoolTarget) Overflow() bool {
+	return time.Now().After(st.nextWriteTime) || st.wal.unsyncedSize() >= st.cacheSize
+}
+
+func (st *spoolTarget) Flush() {
+	st.Sync()
+}
+
+//Sync 同步到磁盘后 把没有确认的日志交给child child Sync成功后确认
+func (st *spoolTarget) Sync() error {
+	if atomic.LoadInt32(&st.closed) != 0 {
+		return errSpoolClosed
+	}
+	w := st.wal
+	end, err := w.sync()
+	st.nextWriteTime = time.Now().Add(st.interval)
+	if err != nil {
+		return err
+	}
+
+	w.ackLocker.Lock()
+	defer w.ackLocker.Unlock()
+	w.enforceLimit(end, st.maxBytes)
+	for w.ackOffset < end {
+		records, next, err := w.readRecords(w.ackOffset, end, st.batchSize)
+		if err != nil {
+			return err
+		}
+		if err := st.deliver(records); err != nil {
+			//下次Sync从ackOffset重新交给child
+			if r, ok := st.child.(Retainer); ok {
+				r.Discard()
+			}
+			return err
+		}
+		w.ackOffset = next
+		if err := w.saveAck(); err != nil {
+			return err
+		}
+		w.removeAcked()
+	}
+	return nil
+}
+
+func (st *spoolTarget) deliver(records []*spoolRecord) error {
+	t, ok := st.child.(ErrorTarget)
+	for _, r := range records {
+		if ok {
+			if err := t.TryWrite(r.event, rawSerializer(r.payload)); err != nil {
+				return err
+			}
+		} else {
+			st.child.Write(r.event, rawSerializer(r.payload))
+		}
+	}
+	if s, ok := st.child.(Syncer); ok {
+		return s.Sync()
+	}
+	st.child.Flush()
+	return nil
+}
+
+//readRecords 从from开始读取最多batchSize条记录 返回下1条记录的位置
+//分段末尾的数据不完整时(如进程崩溃) 跳到下一个分段
+func (w *spoolWAL) readRecords(from int64, end int64, batchSize int) ([]*spoolRecord, int64, error) {
+	segs, err := w.segments()
+	if err != nil {
+		return nil, from, err
+	}
+	i := sort.Search(len(segs), func(i int) bool { return segs[i] > from }) - 1
+	if i < 0 {
+		//from之前的分段已经删除
+		if len(segs) == 0 {
+			return nil, end, nil
+		}
+		return nil, segs[0], nil
+	}
+	segEnd := end
+	if i+1 < len(segs) {
+		segEnd = segs[i+1]
+	}
+	f, err := os.Open(w.segmentPath(segs[i]))
+	if err != nil {
+		return nil, from, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from-segs[i], io.SeekStart); err != nil {
+		return nil, from, err
+	}
+	r := bufio.NewReader(f)
+	var records []*spoolRecord
+	offset := from
+	for offset < segEnd && len(records) < batchSize {
+		record, n, err := readSpoolRecord(r)
+		if err != nil {
+			//分段中剩余的数据无法读取
+			offset = segEnd
+			break
+		}
+		records = append(records, record)
+		offset += n
+	}
+	return records, offset, nil
+}
+
+//enforceLimit 磁盘使用超过maxBytes时删除最早的分段 当前分段不会删除 protected by ackLocker
+func (w *spoolWAL) enforceLimit(end int64, maxBytes int64) {
+	segs, err := w.segments()
+	if err != nil {
+		return
+	}
+	for len(segs) > 1 && end-segs[0] > maxBytes {
+		if w.ackOffset < segs[1] {
+			atomic.AddUint64(&w.dropped, uint64(w.countRecords(segs[0], w.ackOffset, segs[1])))
+			w.ackOffset = segs[1]
+			w.saveAck()
+		}
+		os.Remove(w.segmentPath(segs[0]))
+		segs = segs[1:]
+	}
+}
+
+//countRecords 统计分段中from到end之间的记录数
+func (w *spoolWAL) countRecords(segment int64, from int64, end int64) int {
+	f, err := os.Open(w.segmentPath(segment))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	if from < segment {
+		from = segment
+	}
+	if _, err := f.Seek(from-segment, io.SeekStart); err != nil {
+		return 0
+	}
+	r := bufio.NewReader(f)
+	count := 0
+	for offset := from; offset < end; count++ {
+		_, n, err := readSpoolRecord(r)
+		if err != nil {
+			break
+		}
+		offset += n
+	}
+	return count
+}
+
+//removeAcked 删除已经全部确认的分段
+func (w *spoolWAL) removeAcked() {
+	segs, err := w.segments()
+	if err != nil {
+		return
+	}
+	for i := 0; i+1 < len(segs) && segs[i+1] <= w.ackOffset; i++ {
+		os.Remove(w.segmentPath(segs[i]))
+	}
+}
+
+//segments 返回所有分段的起始位置 从小到大
+func (w *spoolWAL) segments() ([]int64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []int64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".wal") {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, ".wal"), 10, 64)
+		if err == nil {
+			segs = append(segs, start)
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+	return segs, nil
+}
+
+func (w *spoolWAL) segmentPath(start int64) string {
+	return path.Join(w.dir, fmt.Sprintf("%020d.wal", start))
+}
+
+//saveAck 先写入临时文件再改名 避免崩溃时ack文件不完整
+func (w *spoolWAL) saveAck() error {
+	tmp := path.Join(w.dir, "ack.tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(w.ackOffset, 10)), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path.Join(w.dir, "ack"))
+}
+
+//open 读取ack 截断最后1个分段末尾不完整的记录 并继续写入最后1个分段
+func (w *spoolWAL) open() error {
+	if err := os.MkdirAll(w.dir, os.ModePerm); err != nil {
+		return err
+	}
+	if content, err := os.ReadFile(path.Join(w.dir, "ack")); err == nil {
+		w.ackOffset, _ = strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	}
+	segs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	if len(segs) == 0 {
+		w.writeOffset = w.ackOffset
+		return nil
+	}
+	if w.ackOffset < segs[0] {
+		w.ackOffset = segs[0]
+	}
+	last := segs[len(segs)-1]
+	valid := int64(0)
+	if f, err := os.Open(w.segmentPath(last)); err == nil {
+		r := bufio.NewReader(f)
+		for {
+			_, n, err := readSpoolRecord(r)
+			if err != nil {
+				break
+			}
+			valid += n
+		}
+		f.Close()
+	}
+	f, err := os.OpenFile(w.segmentPath(last), os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return err
+	}
+	w.segment = f
+	w.segmentStart = last
+	w.writeOffset = last + valid
+	return nil
+}
+
+//Probe 检查包装的Target
+func (st *spoolTarget) Probe() error {
+	if p, ok := st.child.(Prober); ok {
+		return p.Probe()
+	}
+	return nil
+}
+
+//Close 关闭包装的Target 没有其他spoolTarget使用同一个Dir时关闭当前分段 没有确认的日志在下次打开时重放
+func (st *spoolTarget) Close() error {
+	if !atomic.CompareAndSwapInt32(&st.closed, 0, 1) {
+		return nil
+	}
+	return errors.Join(st.wal.release(), closeTarget(st.child))
+}
+
+func (st *spoolTarget) TargetStats() TargetStats {
+	stats := TargetStats{}
+	if t, ok := st.child.(StatsTarget); ok {
+		stats = t.TargetStats()
+	}
+	stats.Dropped += atomic.LoadUint64(&st.wal.dropped)
+	return stats
+}
+
+//createSpoolTarget 相同Dir的spoolTarget在重新加载时沿用之前打开的分段
+func createSpoolTarget(config map[string]interface{}) Target {
+	st := &spoolTarget{
+		targetFilter: newTargetFilter(config),
+		segmentSize:  int64(configInt(config, "SegmentSize", 1024*1024*8)),
+		maxBytes:     int64(configInt(config, "MaxBytes", 1024*1024*256)),
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 1024*8),
+		batchSize:    configInt(config, "BatchSize", 1000),
+	}
+	tt := configMap(config, "Target")
+	if tt == nil {
+		log.Println("createSpoolTarget: Target missed")
+		return nil
+	}
+	st.child = findTarget(configString(tt, "Type", ""), tt)
+	if st.child == nil {
+		return nil
+	}
+	dir := configString(config, "Dir", "./spool")
+	wal, err := openSpoolWAL(dir)
+	if err != nil {
+		log.Println("createSpoolTarget:", dir, ":", err)
+		closeTarget(st.child)
+		return nil
+	}
+	st.wal = wal
+	st.nextWriteTime = time.Now().Add(st.interval)
+	return st
+}
@@ -0,0 +1,194 @@
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//newTestSpool 创建spoolTarget 并把包装的Target替换为child
+func newTestSpool(t *testing.T, dir string, child Target) *spoolTarget {
+	t.Helper()
+	st := createSpoolTarget(map[string]interface{}{
+		"Dir":    dir,
+		"Target": map[string]interface{}{"Type": "memory", "Key": "spool-test"},
+	}).(*spoolTarget)
+	st.child = child
+	return st
+}
+
+func spoolWrite(t *testing.T, st *spoolTarget, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := st.TryWrite(testEvent(InfoLevel, "app", msg), messageSerializer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpoolTargetReload(t *testing.T) {
+	dir := t.TempDir()
+	child := &retainingTarget{}
+	old := newTestSpool(t, dir, child)
+	spoolWrite(t, old, "a", "b")
+	if err := old.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	spoolWrite(t, old, "c")
+
+	//重新加载配置时 新的Target在旧的Target关闭前创建
+	st := newTestSpool(t, dir, child)
+	if st.wal != old.wal {
+		t.Fatal("spoolTargets with the same Dir should share the WAL")
+	}
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.TryWrite(testEvent(InfoLevel, "app", "closed"), messageSerializer{}); !errors.Is(err, errSpoolClosed) {
+		t.Fatalf("TryWrite after Close = %v", err)
+	}
+	spoolWrite(t, st, "d")
+	if err := st.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(child.delivered, want) {
+		t.Fatalf("delivered = %v, want %v", child.delivered, want)
+	}
+	end := st.wal.writeOffset
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重新打开时分段完整 没有需要重放的日志
+	reopened := newTestSpool(t, dir, &retainingTarget{})
+	defer reopened.Close()
+	if reopened.wal == st.wal || reopened.wal.writeOffset != end || reopened.wal.ackOffset != end {
+		t.Fatalf("writeOffset = %d ackOffset = %d, want %d", reopened.wal.writeOffset, reopened.wal.ackOffset, end)
+	}
+}
+
+func TestSpoolTargetRetainingChild(t *testing.T) {
+	child := &retainingTarget{down: true}
+	st := newTestSpool(t, t.TempDir(), child)
+	defer st.Close()
+	spoolWrite(t, st, "a", "b")
+	for i := 0; i < 2; i++ {
+		if err := st.Sync(); err == nil {
+			t.Fatal("Sync should fail while the child is down")
+		}
+	}
+	//失败时丢弃child保留的日志 由spool从确认的位置重新交给child
+	if child.discards != 2 || st.wal.ackOffset != 0 {
+		t.Fatalf("discards = %d ackOffset = %d", child.discards, st.wal.ackOffset)
+	}
+	child.down = false
+	spoolWrite(t, st, "c")
+	if err := st.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(child.delivered, want) {
+		t.Fatalf("delivered = %v, want %v", child.delivered, want)
+	}
+}
+
+//eventTarget 保存收到的LogEvent
+type eventTarget struct {
+	targetFilter
+	locker sync.Mutex
+	events []*LogEvent //protected by locker
+}
+
+func (et *eventTarget) Write(event *LogEvent, sr Serializer) {
+	et.locker.Lock()
+	defer et.locker.Unlock()
+	et.events = append(et.events, event)
+}
+
+func (et *eventTarget) received() []*LogEvent {
+	et.locker.Lock()
+	defer et.locker.Unlock()
+	return append([]*LogEvent(nil), et.events...)
+}
+
+func (et *eventTarget) Overflow() bool {
+	return false
+}
+
+func (et *eventTarget) Flush() {
+}
+
+func TestSpoolTargetReplayEvent(t *testing.T) {
+	dir := t.TempDir()
+	st := newTestSpool(t, dir, &retainingTarget{down: true})
+	e := testEvent(ErrorLevel, "db", "")
+	e.Format, e.Args = "query %s took %dms", []interface{}{"users", 12}
+	e.Properties = Properties{"user": "alice", "rows": 3, "ratio": 0.5, "tags": []string{"a"}}
+	e.Err = fmt.Errorf("wrap: %w", errors.New("timeout"))
+	e.Caller = &Caller{File: "db.go", Line: 42, Function: "app/db.Query", Package: "app/db"}
+	e.StackTrace = "goroutine 1"
+	if err := st.TryWrite(e, messageSerializer{}); err != nil {
+		t.Fatal(err)
+	}
+	st.Sync()
+	st.Close()
+
+	//重启后重放 LogEvent由磁盘中保存的内容还原
+	child := &eventTarget{}
+	replay := newTestSpool(t, dir, child)
+	defer replay.Close()
+	if err := replay.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(child.events) != 1 {
+		t.Fatalf("got %d events", len(child.events))
+	}
+	got := child.events[0]
+	if got.Message() != "query users took 12ms" || got.Name != "db" || got.Level != ErrorLevel ||
+		!got.Timestamp.Equal(e.Timestamp) || got.Time != e.Time || got.StackTrace != e.StackTrace {
+		t.Fatalf("got %+v", got)
+	}
+	want := Properties{"user": "alice", "rows": int64(3), "ratio": 0.5, "tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(got.Properties, want) {
+		t.Fatalf("Properties = %#v", got.Properties)
+	}
+	if !reflect.DeepEqual(got.Caller, e.Caller) {
+		t.Fatalf("Caller = %+v", got.Caller)
+	}
+	if got.Err == nil || got.Err.Error() != "wrap: timeout" || errorType(got.Err) != "*fmt.wrapError" {
+		t.Fatalf("Err = %v", got.Err)
+	}
+	if info := NewErrorInfo(got.Err); len(info.Chain) != 1 || info.Chain[0].Message != "timeout" {
+		t.Fatalf("ErrorInfo = %+v", info)
+	}
+}
+
+func TestSpoolTargetOTLPChild(t *testing.T) {
+	c := &collector{}
+	otlp := createOTLPTarget(map[string]interface{}{
+		"URL":      newCollector(t, c),
+		"Encoding": "json",
+	})
+	st := newTestSpool(t, t.TempDir(), otlp)
+	defer st.Close()
+	e := testEvent(InfoLevel, "app", "")
+	e.Format, e.Args = "hello %s", []interface{}{"world"}
+	e.Properties = Properties{"user": "alice"}
+	if err := st.TryWrite(e, messageSerializer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	requests := c.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests", len(requests))
+	}
+	for _, want := range []string{`"body":{"stringValue":"hello world"}`, `"key":"user","value":{"stringValue":"alice"}`} {
+		if !strings.Contains(requests[0].body, want) {
+			t.Fatalf("%s missing in %s", want, requests[0].body)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//syslog的facility
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+//syslogSeverity LogLevel对应的syslog severity
+func syslogSeverity(l LogLevel) int {
+	switch l {
+	case TraceLevel, DebugLevel:
+		return 7 //debug
+	case InfoLevel:
+		return 6 //informational
+	case WarnLevel:
+		return 4 //warning
+	case ErrorLevel:
+		return 3 //err
+	case PanicLevel, FatalLevel:
+		return 2 //crit
+	}
+	return 5 //notice
+}
+
+//syslogTarget 通过unixgram udp tcp tls 发送到syslog
+type syslogTarget struct {
+	targetFilter
+	conn      *netConn
+	facility  int
+	appName   string
+	hostname  string
+	pid       int
+	rfc3164   bool          //使用RFC 3164格式 默认RFC 5424
+	octet     bool          //流式连接使用octet-counting分帧 否则以换行分帧
+	interval  time.Duration //只读 写入的时间间隔
+	cacheSize int           //缓存的字节数
+
+	locker      *sync.Mutex
+	pending     [][]byte //protected by locker 每个元素是1条分帧后的消息
+	pendingSize int      //protected by locker
+
+	nextWriteTime time.Time
+	dropped       uint64 //atomic
+	bytesWritten  uint64 //atomic
+}
+
+func (st *syslogTarget) Write(event *LogEvent, sr Serializer) {
+	st.TryWrite(event, sr)
+}
+
+func (st *syslogTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	frame := st.frame(event, bs)
+	st.locker.Lock()
+	st.pending = append(st.pending, frame)
+	st.pendingSize += len(frame)
+	st.locker.Unlock()
+	return nil
+}
+
+//frame 生成1条完整的syslog消息
+func (st *syslogTarget) frame(event *LogEvent, msg []byte) []byte {
+	var buf bytes.Buffer
+	pri := st.facility*8 + syslogSeverity(event.Level)
+	t := eventTime(event)
+	if st.rfc3164 {
+		fmt.Fprintf(&buf, "<%d>%s %s %s[%d]: ", pri, t.Format(time.Stamp), st.hostname, st.appName, st.pid)
+	} else {
+		fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s - ", pri, t.Format("2006-01-02T15:04:05.000000Z07:00"),
+			st.hostname, st.appName, st.pid, syslogField(event.Name, 32))
+	}
+	buf.Write(msg)
+	if !st.conn.stream() {
+		return buf.Bytes()
+	}
+	if st.octet {
+		return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func (st *syslogTarget) Overflow() bool {
+	st.locker.Lock()
+	size := st.pendingSize
+	st.locker.Unlock()
+	return time.Now().After(st.nextWriteTime) || size >= st.cacheSize
+}
+
+func (st *syslogTarget) Flush() {
+	st.Sync()
+}
+
+//Sync 写入所有缓存的消息 写入失败时重连1次 仍然失败则丢弃剩余的消息
+func (st *syslogTarget) Sync() error {
+	st.locker.Lock()
+	pending := st.pending
+	st.pending = nil
+	st.pendingSize = 0
+	st.locker.Unlock()
+	st.nextWriteTime = time.Now().Add(st.interval)
+
+	for i, frame := range pending {
+		err := st.conn.write(frame)
+		if err != nil {
+			//连接已经关闭 write会重新连接
+			err = st.conn.write(frame)
+		}
+		if err != nil {
+			atomic.AddUint64(&st.dropped, uint64(len(pending)-i))
+			return err
+		}
+		atomic.AddUint64(&st.bytesWritten, uint64(len(frame)))
+	}
+	return nil
+}
+
+//Probe 没有连接时尝试连接
+func (st *syslogTarget) Probe() error {
+	return st.conn.dial()
+}
+
+//Close 关闭连接 没有发送的消息在Close之前已经由Manager flush
+func (st *syslogTarget) Close() error {
+	return st.conn.shutdown()
+}
+
+func (st *syslogTarget) TargetStats() TargetStats {
+	return TargetStats{
+		BytesWritten: atomic.LoadUint64(&st.bytesWritten),
+		Dropped:      atomic.LoadUint64(&st.dropped),
+	}
+}
+
+//syslogField 替换空格以及不可打印的字符 为空时返回"-"
+func syslogField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	bs := []byte(s)
+	for i, c := range bs {
+		if c < 33 || c > 126 {
+			bs[i] = '_'
+		}
+	}
+	if len(bs) > max {
+		bs = bs[:max]
+	}
+	return string(bs)
+}
+
+func createSyslogTarget(config map[string]interface{}) Target {
+	st := &syslogTarget{
+		targetFilter: newTargetFilter(config),
+		rfc3164:      configString(config, "Format", "5424") == "3164",
+		octet:        configString(config, "Framing", "octet") == "octet",
+		interval:     configDuration(config, "Interval", time.Second),
+		cacheSize:    configInt(config, "CacheSize", 1024*8),
+		pid:          os.Getpid(),
+		locker:       &sync.Mutex{},
+	}
+	conn, err := newNetConn(config, "unixgram", "/dev/log")
+	if err != nil {
+		log.Println("createSyslogTarget:", err)
+		return nil
+	}
+	st.conn = conn
+
+	facility := configString(config, "Facility", "user")
+	if v, ok := syslogFacilities[facility]; ok {
+		st.facility = v
+	} else {
+		st.facility = syslogFacilities["user"]
+	}
+	hostname, _ := os.Hostname()
+	st.hostname = syslogField(configString(config, "Hostname", hostname), 255)
+	st.appName = syslogField(configString(config, "AppName", path.Base(os.Args[0])), 48)
+	st.nextWriteTime = time.Now().Add(st.interval)
+	return st
+}
@@ -0,0 +1,202 @@
+package glog
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//testEvent 固定时间的日志
+func testEvent(level LogLevel, name string, msg string) *LogEvent {
+	ts := time.Date(2024, 3, 5, 7, 8, 9, 123456000, time.UTC)
+	return &LogEvent{
+		Level:     level,
+		LevelDesc: levelName(level),
+		Name:      name,
+		Args:      []interface{}{msg},
+		Time:      ts.Format("2006-01-02 15:04:05.0000"),
+		Timestamp: ts,
+	}
+}
+
+//messageSerializer 只输出消息 便于比较
+type messageSerializer struct{}
+
+func (messageSerializer) Encode(e *LogEvent) []byte {
+	return []byte(e.Message())
+}
+
+//listenPacket 返回接收数据报的channel
+func listenPacket(t *testing.T, network string, address string) (net.PacketConn, <-chan []byte) {
+	t.Helper()
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	ch := make(chan []byte, 256)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				close(ch)
+				return
+			}
+			ch <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	return pc, ch
+}
+
+//listenStream 返回第1个连接关闭前收到的所有数据
+func listenStream(t *testing.T) (net.Listener, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(ch)
+			return
+		}
+		defer conn.Close()
+		content, _ := io.ReadAll(conn)
+		ch <- content
+	}()
+	return ln, ch
+}
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case b := <-ch:
+		return b
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+func TestSyslogTargetDatagram(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		event  *LogEvent
+		want   string
+	}{
+		{
+			name:   "rfc5424",
+			format: "5424",
+			event:  testEvent(WarnLevel, "db pool", "slow query"),
+			want:   `^<132>1 2024-03-05T07:08:09\.123456Z myhost myapp \d+ db_pool - slow query$`,
+		},
+		{
+			name:   "rfc5424 empty name",
+			format: "5424",
+			event:  testEvent(ErrorLevel, "", "failed"),
+			want:   `^<131>1 2024-03-05T07:08:09\.123456Z myhost myapp \d+ - - failed$`,
+		},
+		{
+			name:   "rfc3164",
+			format: "3164",
+			event:  testEvent(InfoLevel, "db", "connected"),
+			want:   `^<134>Mar  5 07:08:09 myhost myapp\[\d+\]: connected$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, ch := listenPacket(t, "udp", "127.0.0.1:0")
+			target := createSyslogTarget(map[string]interface{}{
+				"Network":  "udp",
+				"Address":  pc.LocalAddr().String(),
+				"Facility": "local0",
+				"Hostname": "myhost",
+				"AppName":  "myapp",
+				"Format":   tt.format,
+			}).(*syslogTarget)
+			defer target.Close()
+			if err := target.TryWrite(tt.event, messageSerializer{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := target.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			got := string(receive(t, ch))
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Fatalf("got %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogTargetStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing string
+		want    string
+	}{
+		{"octet counting", "octet", `^(\d+) (<14>1 [^\n]*first)(\d+) (<14>1 [^\n]*second\nline)$`},
+		{"newline", "newline", `^(<14>1 [^\n]*first)\n(<14>1 [^\n]*second)\n(line)\n$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, ch := listenStream(t)
+			target := createSyslogTarget(map[string]interface{}{
+				"Network": "tcp",
+				"Address": ln.Addr().String(),
+				"Framing": tt.framing,
+			}).(*syslogTarget)
+			target.TryWrite(testEvent(InfoLevel, "app", "first"), messageSerializer{})
+			target.TryWrite(testEvent(InfoLevel, "app", "second\nline"), messageSerializer{})
+			if err := target.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			target.Close()
+			got := string(receive(t, ch))
+			m := regexp.MustCompile(tt.want).FindStringSubmatch(got)
+			if m == nil {
+				t.Fatalf("got %q, want %s", got, tt.want)
+			}
+			if tt.framing == "octet" {
+				//长度为后面消息的字节数
+				for i := 1; i < len(m); i += 2 {
+					if m[i] != strconv.Itoa(len(m[i+1])) {
+						t.Fatalf("octet count %s for %q", m[i], m[i+1])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSyslogTargetUnixgram(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log.sock")
+	_, ch := listenPacket(t, "unixgram", socket)
+	target := createSyslogTarget(map[string]interface{}{
+		"Address":  socket,
+		"Hostname": "myhost",
+		"AppName":  "myapp",
+	}).(*syslogTarget)
+	target.TryWrite(testEvent(DebugLevel, "app", "hello"), messageSerializer{})
+	if err := target.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	got := string(receive(t, ch))
+	if !regexp.MustCompile(`^<15>1 \S+ myhost myapp \d+ app - hello$`).MatchString(got) {
+		t.Fatalf("got %q", got)
+	}
+	target.Close()
+	target.TryWrite(testEvent(DebugLevel, "app", "after close"), messageSerializer{})
+	if err := target.Sync(); err == nil {
+		t.Fatal("Sync after Close should fail")
+	}
+}
@@ -1,5 +1,9 @@
 package glog
 
+import (
+	"time"
+)
+
 //Target 日志文件写入
 type Target interface {
 	Name() string
@@ -10,6 +14,43 @@ type Target interface {
 	Flush()                               //manager保证同一时刻只有1个routine调用 manager保证 Overflow()和Flush() 在同一个routine中调用
 }
 
+//Syncer Target可选实现 Manager.Flush时代替Flush调用 返回写入失败的错误
+type Syncer interface {
+	Sync() error //manager保证与Overflow()和Flush()不会同时调用
+}
+
+//ErrorTarget 扩展Target 写入失败时返回错误 Manager通过ErrorHandler报告这些错误
+type ErrorTarget interface {
+	Target
+	Syncer
+	TryWrite(event *LogEvent, sr Serializer) error //代替Write调用
+}
+
+//Closer Target可选实现 释放连接 文件等资源 调用后不会再写入
+//Manager重新加载配置时对不再使用的Target调用 Manager.Close时对所有Target调用
+type Closer interface {
+	Close() error //manager保证与Write() Flush()和Sync()不会同时调用
+}
+
+//closeTarget 实现了Closer时调用Close
+func closeTarget(t Target) error {
+	if c, ok := t.(Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+//Prober Target可选实现 检查Target当前是否可以写入 如网络是否连通 目录是否可写
+type Prober interface {
+	Probe() error //manager保证与Flush()和Sync()不会同时调用
+}
+
+//Retainer Target可选实现 表示Sync失败时Target自己保留没有发送的日志 在之后的Sync中重试
+//failover spool等自己重试的Target在子Target失败时调用Discard 避免同一批日志发送两次
+type Retainer interface {
+	Discard() //丢弃保留的日志 manager保证与Flush()和Sync()不会同时调用
+}
+
 func toLevel(l string) LogLevel {
 	if l == "Trace" {
 		return TraceLevel
@@ -21,8 +62,148 @@ func toLevel(l string) LogLevel {
 		return WarnLevel
 	} else if l == "Error" {
 		return ErrorLevel
+	} else if l == "Panic" {
+		return PanicLevel
 	} else if l == "Fatal" {
 		return FatalLevel
 	}
 	return EveryLevel
 }
+
+//levelName 返回级别的文本描述 与LogEvent.LevelDesc一致
+func levelName(l LogLevel) string {
+	switch l {
+	case TraceLevel:
+		return "TRACE"
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	case PanicLevel:
+		return "PANIC"
+	case FatalLevel:
+		return "FATAL"
+	}
+	return "EVERY"
+}
+
+//copyEvent 复制Properties和Args 缓存LogEvent的Target使用 避免调用者之后修改或者并发访问
+func copyEvent(event *LogEvent) LogEvent {
+	e := *event
+	if event.Properties != nil {
+		e.Properties = make(Properties, len(event.Properties))
+		for k, v := range event.Properties {
+			e.Properties[k] = v
+		}
+	}
+	if event.Args != nil {
+		e.Args = append([]interface{}(nil), event.Args...)
+	}
+	return e
+}
+
+//eventTime 返回event的时间 WriteEvent直接写入且没有设置Timestamp时 解析Time
+func eventTime(e *LogEvent) time.Time {
+	if !e.Timestamp.IsZero() {
+		return e.Timestamp
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05.0000", e.Time, time.Local); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+//targetFilter Target共用的Name MinLevel MaxLevel
+type targetFilter struct {
+	name     string   //只读
+	minLevel LogLevel //只读
+	maxLevel LogLevel //只读
+}
+
+func newTargetFilter(config map[string]interface{}) targetFilter {
+	return targetFilter{
+		name:     configString(config, "Name", "*"),
+		minLevel: toLevel(configString(config, "MinLevel", "")),
+		maxLevel: toLevel(configString(config, "MaxLevel", "")),
+	}
+}
+
+func (tf *targetFilter) Name() string {
+	return tf.name
+}
+
+func (tf *targetFilter) MinLevel() LogLevel {
+	return tf.minLevel
+}
+
+func (tf *targetFilter) MaxLevel() LogLevel {
+	return tf.maxLevel
+}
+
+//configString 读取字符串配置 不存在或类型不对时返回def
+func configString(config map[string]interface{}, key string, def string) string {
+	if v, ok := config[key].(string); ok {
+		return v
+	}
+	return def
+}
+
+//configInt 读取整数配置 json中的数字是float64
+func configInt(config map[string]interface{}, key string, def int) int {
+	switch v := config[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return def
+}
+
+//configFloat 读取小数配置
+func configFloat(config map[string]interface{}, key string, def float64) float64 {
+	switch v := config[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return def
+}
+
+func configBool(config map[string]interface{}, key string, def bool) bool {
+	if v, ok := config[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+//configDuration 读取时间配置 数字的单位为秒 字符串使用time.ParseDuration 如"500ms"
+func configDuration(config map[string]interface{}, key string, def time.Duration) time.Duration {
+	switch v := config[key].(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	case int:
+		return time.Duration(v) * time.Second
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+//configMap 读取对象配置
+func configMap(config map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := config[key].(map[string]interface{}); ok {
+		return v
+	}
+	return nil
+}
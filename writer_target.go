@@ -0,0 +1,107 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+//WriterOptions NewWriterTarget的选项 零值表示不过滤 不缓存
+type WriterOptions struct {
+	Name       string //只写入该名字的Logger 为空时写入所有
+	MinLevel   LogLevel
+	MaxLevel   LogLevel
+	BufferSize int           //大于0时先缓存 超过BufferSize或者Interval后写入
+	Interval   time.Duration //缓存写入的时间间隔 默认1秒
+}
+
+//writerTarget 写入任意io.Writer
+type writerTarget struct {
+	targetFilter
+	w          io.Writer
+	bufferSize int
+	interval   time.Duration
+
+	locker *sync.Mutex
+	buf    bytes.Buffer //protected by locker
+
+	nextWriteTime time.Time
+}
+
+//NewWriterTarget 返回写入w的Target 每条日志以换行结尾
+//w实现了Flush() error时(如bufio.Writer gzip.Writer) Sync时会调用
+func NewWriterTarget(w io.Writer, opts WriterOptions) Target {
+	wt := &writerTarget{
+		targetFilter: targetFilter{
+			name:     opts.Name,
+			minLevel: opts.MinLevel,
+			maxLevel: opts.MaxLevel,
+		},
+		w:          w,
+		bufferSize: opts.BufferSize,
+		interval:   opts.Interval,
+		locker:     &sync.Mutex{},
+	}
+	if wt.name == "" {
+		wt.name = "*"
+	}
+	if wt.interval <= 0 {
+		wt.interval = time.Second
+	}
+	wt.nextWriteTime = time.Now().Add(wt.interval)
+	return wt
+}
+
+func (wt *writerTarget) Write(event *LogEvent, sr Serializer) {
+	wt.TryWrite(event, sr)
+}
+
+func (wt *writerTarget) TryWrite(event *LogEvent, sr Serializer) error {
+	bs := sr.Encode(event)
+	if bs == nil {
+		bs = []byte(fmt.Sprintf("%+v", event))
+	}
+	wt.locker.Lock()
+	defer wt.locker.Unlock()
+	if wt.bufferSize > 0 {
+		wt.buf.Write(bs)
+		wt.buf.WriteByte('\n')
+		return nil
+	}
+	//不缓存时1条日志只调用1次Write
+	line := make([]byte, len(bs)+1)
+	copy(line, bs)
+	line[len(bs)] = '\n'
+	_, err := wt.w.Write(line)
+	return err
+}
+
+func (wt *writerTarget) Overflow() bool {
+	wt.locker.Lock()
+	size := wt.buf.Len()
+	wt.locker.Unlock()
+	return time.Now().After(wt.nextWriteTime) || (wt.bufferSize > 0 && size >= wt.bufferSize)
+}
+
+func (wt *writerTarget) Flush() {
+	wt.Sync()
+}
+
+func (wt *writerTarget) Sync() error {
+	wt.locker.Lock()
+	defer wt.locker.Unlock()
+	wt.nextWriteTime = time.Now().Add(wt.interval)
+	var err error
+	if wt.buf.Len() > 0 {
+		_, err = wt.w.Write(wt.buf.Bytes())
+		wt.buf.Reset()
+	}
+	if f, ok := wt.w.(interface{ Flush() error }); ok {
+		if e := f.Flush(); err == nil {
+			err = e
+		}
+	}
+	return err
+}